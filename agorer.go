@@ -1,13 +1,22 @@
 package agorer
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/igolaizola/agorer/pkg/agora"
 	"github.com/igolaizola/agorer/pkg/isbn"
 	"github.com/igolaizola/agorer/pkg/mail"
+	"github.com/igolaizola/agorer/pkg/sinli"
 )
 
 type Config struct {
@@ -20,6 +29,16 @@ type Config struct {
 	OutputType string
 
 	AgoraToken string
+	// Retries of transient agora failures and wait before the first one
+	AgoraRetries   int
+	AgoraRetryWait time.Duration
+	// Days exported concurrently from agora, defaults to 4
+	AgoraWorkers int
+	// Agora client used instead of the input, for example a fake in tests
+	Agora agora.API
+	// Time zone of the store, like `Europe/Madrid`, the local one if empty.
+	// The command line defaults to `Europe/Madrid`
+	Timezone string
 
 	ISBNDir string
 
@@ -28,17 +47,55 @@ type Config struct {
 	SINLIDestinationEmail string
 	SINLIDestinationID    string
 	SINLIClientName       string
+	// Document version, defaults to the latest one
+	SINLIVersion int
+	// Normalized (N) or free (L) format, defaults to normalized
+	SINLIFormat   string
+	SINLIStrict   bool
+	SINLITruncate bool
+	// Fallback for characters that can't be encoded (transliterate, replace),
+	// fails if empty
+	SINLIFallback string
+	// File to store transmission numbers, defaults to the log dir
+	SINLITransmissionsFile string
+	// Send a sinli sales file for each day instead of one for the whole range
+	SINLIDaily bool
+
+	// Comma separated warehouse IDs counted in the stock, all if empty
+	StockWarehouses string
+	// Comma separated warehouse ID and sinli source ID pairs, like
+	// `1:L0000001,2:L0000002`, to send a stock file for each source ID with
+	// the quantities of its warehouses
+	StockWarehouseSources string
+
+	// Price list ID of the catalog prices, the first one not deleted if zero
+	CatalogPriceList int
 
 	Mail mail.Config
 }
 
 type Store struct {
-	Products   map[int]agora.Product
-	Books      map[int]agora.Product
-	Vats       map[int]agora.Vat
-	PriceLists map[int]agora.PriceList
-	Quantity   map[int]int
-	ISBNs      map[int]string
+	// Products not deleted, books or not
+	Products       map[int]agora.Product
+	Books          map[int]agora.Product
+	Vats           map[int]agora.Vat
+	PriceLists     map[int]agora.PriceList
+	Families       map[int]agora.Family
+	Warehouses     map[int]agora.Warehouse
+	Workplaces     map[int]agora.WorkplacesSummary
+	Users          map[int]agora.User
+	Customers      map[int]agora.Customer
+	Suppliers      map[int]agora.Supplier
+	PaymentMethods map[int]agora.PaymentMethod
+	// Quantity of each book in all the warehouses
+	Quantity map[int]int
+	// Quantity of each book by warehouse ID
+	WarehouseQuantity map[int]map[int]int
+	ISBNs             map[int]string
+	// Product IDs by ISBN without hyphens
+	ISBNIndex map[string]int
+	// Supplier IDs by CIF, upper case and without spaces or hyphens
+	SupplierIndex map[string]int
 }
 
 func NewStore(ctx context.Context, master *agora.Master, isbnCli *isbn.Client) *Store {
@@ -47,12 +104,15 @@ func NewStore(ctx context.Context, master *agora.Master, isbnCli *isbn.Client) *
 		vats[vat.ID] = vat
 	}
 
+	products := map[int]agora.Product{}
 	books := map[int]agora.Product{}
 	isbns := map[int]string{}
+	isbnIndex := map[string]int{}
 	for _, pr := range master.Products {
 		if pr.DeletionDate != "" {
 			continue
 		}
+		products[pr.ID] = pr
 		barcode := pr.Barcode()
 		if !isbn.Valid(barcode) {
 			continue
@@ -75,6 +135,7 @@ func NewStore(ctx context.Context, master *agora.Master, isbnCli *isbn.Client) *
 			continue
 		}
 		isbns[pr.ID] = isbnCode
+		isbnIndex[barcode] = pr.ID
 		books[pr.ID] = pr
 	}
 
@@ -83,18 +144,357 @@ func NewStore(ctx context.Context, master *agora.Master, isbnCli *isbn.Client) *
 		priceLists[pl.ID] = pl
 	}
 
+	families := map[int]agora.Family{}
+	for _, f := range master.Families {
+		families[f.ID] = f
+	}
+	warehouses := map[int]agora.Warehouse{}
+	for _, w := range master.Warehouses {
+		warehouses[w.ID] = w
+	}
+	workplaces := map[int]agora.WorkplacesSummary{}
+	for _, w := range master.WorkplacesSummary {
+		workplaces[w.ID] = w
+	}
+	users := map[int]agora.User{}
+	for _, u := range master.Users {
+		users[u.ID] = u
+	}
+	customers := map[int]agora.Customer{}
+	for _, c := range master.Customers {
+		customers[c.ID] = c
+	}
+	suppliers := map[int]agora.Supplier{}
+	supplierIndex := map[string]int{}
+	for _, sp := range master.Suppliers {
+		suppliers[sp.ID] = sp
+		if cif := normalizeCIF(sp.Cif); cif != "" && sp.DeletionDate == "" {
+			supplierIndex[cif] = sp.ID
+		}
+	}
+	paymentMethods := map[int]agora.PaymentMethod{}
+	for _, pm := range master.PaymentMethods {
+		paymentMethods[pm.ID] = pm
+	}
+
 	quantity := map[int]int{}
+	warehouseQuantity := map[int]map[int]int{}
 	for _, st := range master.Stocks {
 		if _, ok := books[st.ProductID]; !ok {
 			continue
 		}
 		quantity[st.ProductID] += int(st.Quantity)
+		if warehouseQuantity[st.ProductID] == nil {
+			warehouseQuantity[st.ProductID] = map[int]int{}
+		}
+		warehouseQuantity[st.ProductID][st.WarehouseID] += int(st.Quantity)
 	}
 	return &Store{
-		Books:      books,
-		Vats:       vats,
-		PriceLists: priceLists,
-		Quantity:   quantity,
-		ISBNs:      isbns,
+		Products:          products,
+		Books:             books,
+		Vats:              vats,
+		PriceLists:        priceLists,
+		Families:          families,
+		Warehouses:        warehouses,
+		Workplaces:        workplaces,
+		Users:             users,
+		Customers:         customers,
+		Suppliers:         suppliers,
+		PaymentMethods:    paymentMethods,
+		Quantity:          quantity,
+		WarehouseQuantity: warehouseQuantity,
+		ISBNs:             isbns,
+		ISBNIndex:         isbnIndex,
+		SupplierIndex:     supplierIndex,
+	}
+}
+
+// Book returns the book with the given ISBN, with or without hyphens.
+func (s *Store) Book(code string) (agora.Product, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), "-", "")
+	id, ok := s.ISBNIndex[code]
+	if !ok {
+		return agora.Product{}, false
+	}
+	p, ok := s.Books[id]
+	return p, ok
+}
+
+// QuantityIn returns the quantity of each book in the given warehouses, or
+// in all of them if none is given.
+func (s *Store) QuantityIn(warehouses ...int) map[int]int {
+	if len(warehouses) == 0 {
+		return s.Quantity
+	}
+	quantity := map[int]int{}
+	for id, byWarehouse := range s.WarehouseQuantity {
+		for _, w := range warehouses {
+			if q, ok := byWarehouse[w]; ok {
+				quantity[id] += q
+			}
+		}
+	}
+	return quantity
+}
+
+// Family returns the family of the product.
+func (s *Store) Family(p agora.Product) (agora.Family, bool) {
+	f, ok := s.Families[p.FamilyID]
+	return f, ok
+}
+
+// FamilyPath returns the names of the family of the product and its parent
+// families, starting from the root one.
+func (s *Store) FamilyPath(p agora.Product) []string {
+	var path []string
+	seen := map[int]struct{}{}
+	f, ok := s.Family(p)
+	for ok {
+		// Avoid loops in malformed data
+		if _, dup := seen[f.ID]; dup {
+			break
+		}
+		seen[f.ID] = struct{}{}
+		path = append([]string{f.Name}, path...)
+		if f.ParentFamilyID == nil {
+			break
+		}
+		f, ok = s.Families[*f.ParentFamilyID]
+	}
+	return path
+}
+
+// Supplier returns the supplier with the given CIF.
+func (s *Store) Supplier(cif string) (agora.Supplier, bool) {
+	id, ok := s.SupplierIndex[normalizeCIF(cif)]
+	if !ok {
+		return agora.Supplier{}, false
+	}
+	sp, ok := s.Suppliers[id]
+	return sp, ok
+}
+
+func normalizeCIF(cif string) string {
+	cif = strings.ToUpper(cif)
+	for _, c := range []string{" ", "-", "."} {
+		cif = strings.ReplaceAll(cif, c, "")
+	}
+	return cif
+}
+
+// agoraHost returns the host of the agora server, serving the master file
+// with a mock server if the input is an agora json file.
+func agoraHost(ctx context.Context, c *Config) (string, error) {
+	switch c.InputType {
+	case "agora":
+		if c.AgoraToken == "" {
+			return "", errors.New("agora token must be provided")
+		}
+		return c.Input, nil
+	case "agora-json":
+		port, err := agora.MockServe(ctx, ":0", c.Input)
+		if err != nil {
+			return "", fmt.Errorf("couldn't mock serve agora: %w", err)
+		}
+		return fmt.Sprintf("http://localhost:%d", port), nil
+	default:
+		return "", fmt.Errorf("invalid input type %s", c.InputType)
+	}
+}
+
+// agoraAPI returns the agora client of the config or a client for the agora
+// input.
+func (c *Config) agoraAPI(ctx context.Context) (agora.API, error) {
+	if c.Agora != nil {
+		return c.Agora, nil
+	}
+	// Agora timestamps are read in the time zone of the store
+	loc, err := agora.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	host, err := agoraHost(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	opts := []agora.Option{
+		agora.WithArchiveDir(c.LogDir),
+		agora.WithRetries(c.AgoraRetries),
+		agora.WithLocation(loc),
+	}
+	if c.AgoraRetryWait > 0 {
+		opts = append(opts, agora.WithBackoff(c.AgoraRetryWait, time.Minute))
+	}
+	if c.AgoraWorkers > 0 {
+		opts = append(opts, agora.WithWorkers(c.AgoraWorkers))
+	}
+	return agora.New(host, c.AgoraToken, opts...), nil
+}
+
+// loadMaster exports master data from agora.
+func loadMaster(ctx context.Context, c *Config) (*agora.Master, error) {
+	client, err := c.agoraAPI(ctx)
+	if err != nil {
+		return nil, err
+	}
+	master, err := client.ExportMaster(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get master: %w", err)
+	}
+	return master, nil
+}
+
+// loadStore exports master data from agora and creates a store with it.
+func loadStore(ctx context.Context, c *Config) (*Store, *agora.Master, error) {
+	if c.ISBNDir == "" {
+		return nil, nil, errors.New("isbn dir must be provided")
+	}
+
+	// Export master data from Agora
+	master, err := loadMaster(ctx, c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Create isbn client
+	isbnClient, err := isbn.New(filepath.Join(c.ISBNDir, "isbn.json"), filepath.Join(c.ISBNDir, "isbn_err.json"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't create isbn client: %w", err)
+	}
+
+	// Create store using master data and isbn client
+	return NewStore(ctx, master, isbnClient), master, nil
+}
+
+func (c *Config) sinliOptions() sinli.MarshalOptions {
+	return sinli.MarshalOptions{
+		Strict:   c.SINLIStrict,
+		Truncate: c.SINLITruncate,
+		Fallback: sinli.Fallback(c.SINLIFallback),
+	}
+}
+
+func (c *Config) validateFallback() error {
+	switch sinli.Fallback(c.SINLIFallback) {
+	case sinli.FallbackNone, sinli.FallbackTransliterate, sinli.FallbackReplace:
+		return nil
+	default:
+		return fmt.Errorf("invalid sinli fallback %s", c.SINLIFallback)
+	}
+}
+
+// sinliVersion returns the configured document version, checking that its
+// layout is registered.
+func (c *Config) sinliVersion(fileType sinli.FileType, def sinli.FileVersion) (sinli.FileVersion, error) {
+	version := def
+	if c.SINLIVersion != 0 {
+		version = sinli.FileVersion(c.SINLIVersion)
+	}
+	if _, err := sinli.New(fileType, version); err != nil {
+		return 0, fmt.Errorf("invalid sinli version: %w", err)
+	}
+	return version, nil
+}
+
+func (c *Config) sinliFormat() (sinli.FormatType, error) {
+	switch format := sinli.FormatType(strings.ToUpper(c.SINLIFormat)); format {
+	case "":
+		return sinli.FormatTypeNormalized, nil
+	case sinli.FormatTypeNormalized, sinli.FormatTypeFree:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid sinli format %s", c.SINLIFormat)
+	}
+}
+
+func (c *Config) stockWarehouses() ([]int, error) {
+	var warehouses []int
+	for _, v := range strings.Split(c.StockWarehouses, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stock warehouse %s", v)
+		}
+		warehouses = append(warehouses, id)
+	}
+	return warehouses, nil
+}
+
+// stockWarehouseSources returns a stock feed for each source ID with its
+// warehouses, in the order they are configured.
+func (c *Config) stockWarehouseSources() ([]stockFeed, error) {
+	var feeds []stockFeed
+	index := map[string]int{}
+	for _, v := range strings.Split(c.StockWarehouseSources, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		warehouse, sourceID, ok := strings.Cut(v, ":")
+		id, err := strconv.Atoi(strings.TrimSpace(warehouse))
+		sourceID = strings.TrimSpace(sourceID)
+		if !ok || err != nil || sourceID == "" {
+			return nil, fmt.Errorf("invalid stock warehouse source %s, must be warehouse-id:source-id", v)
+		}
+		i, ok := index[sourceID]
+		if !ok {
+			i = len(feeds)
+			index[sourceID] = i
+			feeds = append(feeds, stockFeed{sourceID: sourceID})
+		}
+		feeds[i].warehouses = append(feeds[i].warehouses, id)
+	}
+	return feeds, nil
+}
+
+func (c *Config) transmissionsFile() string {
+	if c.SINLITransmissionsFile != "" {
+		return c.SINLITransmissionsFile
+	}
+	return filepath.Join(c.LogDir, "transmissions.json")
+}
+
+// writeSINLI creates the output file and writes the sinli records to it as
+// they are encoded.
+// Characters replaced by the fallback are reported to a file in the log dir.
+func (c *Config) writeSINLI(output string, fn func(enc *sinli.Encoder) error) error {
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("couldn't create file %s: %w", output, err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := sinli.NewEncoder(w)
+	opts := c.sinliOptions()
+	replacements := []sinli.Replacement{}
+	opts.OnReplace = func(r sinli.Replacement) {
+		replacements = append(replacements, r)
+	}
+	enc.SetOptions(opts)
+	if err := fn(enc); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("couldn't write file %s: %w", output, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("couldn't close file %s: %w", output, err)
+	}
+
+	// Write replacements to file
+	if len(replacements) > 0 {
+		log.Printf("❌ %d characters couldn't be encoded and were replaced\n", len(replacements))
+		b, err := json.MarshalIndent(replacements, "", "  ")
+		if err != nil {
+			return fmt.Errorf("couldn't marshal replacements: %w", err)
+		}
+		file := filepath.Join(c.LogDir, fmt.Sprintf("replacements_%s.json", time.Now().Format("20060102_150405")))
+		if err := os.WriteFile(file, b, 0644); err != nil {
+			return fmt.Errorf("couldn't write file %s: %w", file, err)
+		}
 	}
+	return nil
 }
@@ -0,0 +1,160 @@
+package agorer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/igolaizola/agorer/pkg/agora"
+)
+
+var dateRegexp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// Anonymize replaces the personal data of agora master and day json files
+// with pseudonyms and writes them to the output directory, as `master.json`
+// and `2006-01-02.json` files that can be served with the mock server.
+// Directories are replaced with the json files they contain.
+// The same key must be used to anonymize files separately and keep the
+// pseudonyms consistent, a random one is used if it's empty.
+// Only the fields modelled in the agora package are written, unknown ones
+// are dropped as they may contain personal data.
+// Timestamps without time zone are read in the time zone of the store, like
+// `Europe/Madrid` or the local one if empty, and written with its offset.
+func Anonymize(ctx context.Context, output, key, timezone string, inputs ...string) error {
+	if output == "" {
+		return errors.New("output must be provided")
+	}
+	if len(inputs) == 0 {
+		return errors.New("input must be provided")
+	}
+	loc, err := agora.LoadLocation(timezone)
+	if err != nil {
+		return err
+	}
+	files, err := jsonFiles(inputs)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(output, 0755); err != nil {
+		return fmt.Errorf("couldn't create output dir %s: %w", output, err)
+	}
+	a, err := agora.NewAnonymizer(key)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("couldn't read file %s: %w", file, err)
+		}
+		// Files that aren't json objects, like archived error responses, are
+		// skipped
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(b, &keys); err != nil {
+			log.Printf("Skipped %s, it isn't an agora export: %v\n", file, err)
+			continue
+		}
+
+		var v any
+		var name string
+		switch {
+		case hasKeys(keys, "Invoices", "PosCloseOuts", "SystemCloseOuts"):
+			var day agora.Day
+			if err := agora.Unmarshal(b, &day, loc); err != nil {
+				return fmt.Errorf("couldn't unmarshal day %s: %w", file, err)
+			}
+			date := dayDate(file, &day)
+			if date == "" {
+				return fmt.Errorf("couldn't obtain business day of %s", file)
+			}
+			a.Day(&day)
+			v = day
+			name = fmt.Sprintf("%s.json", date)
+		case hasKeys(keys, "Products", "Vats", "Users", "Customers", "Warehouses", "Stocks"):
+			var master agora.Master
+			if err := agora.Unmarshal(b, &master, loc); err != nil {
+				return fmt.Errorf("couldn't unmarshal master %s: %w", file, err)
+			}
+			a.Master(&master)
+			v = master
+			name = "master.json"
+		default:
+			log.Printf("Skipped %s, it isn't an agora export\n", file)
+			continue
+		}
+
+		js, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("couldn't marshal json: %w", err)
+		}
+		out := filepath.Join(output, name)
+		if err := os.WriteFile(out, js, 0644); err != nil {
+			return fmt.Errorf("couldn't write file %s: %w", out, err)
+		}
+		log.Printf("Anonymized %s to %s\n", file, out)
+	}
+	return nil
+}
+
+// jsonFiles returns the input files, replacing directories with the json
+// files they contain.
+func jsonFiles(inputs []string) ([]string, error) {
+	var files []string
+	for _, input := range inputs {
+		fi, err := os.Stat(input)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't stat %s: %w", input, err)
+		}
+		if !fi.IsDir() {
+			files = append(files, input)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(input, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't list %s: %w", input, err)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// hasKeys returns true if the json has any of the keys.
+func hasKeys(keys map[string]json.RawMessage, names ...string) bool {
+	for _, k := range names {
+		if _, ok := keys[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dayDate returns the business day of a day export, obtained from the file
+// name, like the archived `export-business-day-2006-01-02_*.json` files, or
+// from its documents.
+func dayDate(file string, d *agora.Day) string {
+	if date := dateRegexp.FindString(filepath.Base(file)); date != "" {
+		return date
+	}
+	var days []agora.Date
+	for _, inv := range d.Invoices {
+		days = append(days, inv.BusinessDay)
+	}
+	for _, c := range d.PosCloseOuts {
+		days = append(days, c.BusinessDay)
+	}
+	for _, c := range d.SystemCloseOuts {
+		days = append(days, c.BusinessDay)
+	}
+	for _, day := range days {
+		if !day.IsZero() {
+			return day.Format("2006-01-02")
+		}
+	}
+	return ""
+}
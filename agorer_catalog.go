@@ -0,0 +1,243 @@
+package agorer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/agora"
+	"github.com/igolaizola/agorer/pkg/money"
+	"github.com/igolaizola/agorer/pkg/sinli"
+)
+
+// Catalog parses a sinli catalog and generates the agora products to be
+// created for the missing titles and the price changes of the existing ones.
+func Catalog(ctx context.Context, c *Config, file string) error {
+	// Validate config
+	if file == "" {
+		return errors.New("catalog file must be provided")
+	}
+	if c.Input == "" {
+		return errors.New("input must be provided")
+	}
+	if c.LogDir == "" {
+		return errors.New("log dir must be provided")
+	}
+	output := c.Output
+	if output == "" {
+		output = filepath.Join(c.LogDir, fmt.Sprintf("catalog_%s.json", time.Now().Format("20060102_150405")))
+	}
+
+	// Create log dir if it doesn't exist
+	if err := os.MkdirAll(c.LogDir, 0755); err != nil {
+		return fmt.Errorf("couldn't create log dir %s: %w", c.LogDir, err)
+	}
+
+	// Read sinli catalog
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("couldn't read file %s: %w", file, err)
+	}
+	var catalog sinli.Catalog
+	if err := sinli.Unmarshal(b, &catalog); err != nil {
+		return fmt.Errorf("couldn't unmarshal sinli catalog: %w", err)
+	}
+	if doc := catalog.IdentificationHeader.Document; doc != sinli.FileTypeCatalog {
+		return fmt.Errorf("invalid document type %s, expected %s", doc, sinli.FileTypeCatalog)
+	}
+
+	master, err := loadMaster(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	report, err := CatalogItems(ctx, master, &catalog, c.CatalogPriceList)
+	if err != nil {
+		return fmt.Errorf("couldn't generate catalog report: %w", err)
+	}
+
+	// Write report to json file
+	b, err = json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal json: %w", err)
+	}
+	if err := os.WriteFile(output, b, 0644); err != nil {
+		return fmt.Errorf("couldn't write file %s: %w", output, err)
+	}
+	return nil
+}
+
+type CatalogReport struct {
+	Products     []CatalogProduct     `json:"products"`
+	PriceChanges []CatalogPriceChange `json:"price_changes"`
+}
+
+// CatalogProduct is a product to be created in agora.
+type CatalogProduct struct {
+	Name        string       `json:"name"`
+	Barcode     string       `json:"barcode"`
+	PriceListID int          `json:"price_list_id"`
+	Price       money.Amount `json:"price"`
+	VatID       int          `json:"vat_id"`
+}
+
+type CatalogPriceChange struct {
+	ProductID   int          `json:"product_id"`
+	Name        string       `json:"name"`
+	Barcode     string       `json:"barcode"`
+	PriceListID int          `json:"price_list_id"`
+	OldPrice    money.Amount `json:"old_price"`
+	NewPrice    money.Amount `json:"new_price"`
+}
+
+// CatalogItems compares the catalog books with the master products, matching
+// them by barcode.
+// Prices are set for the given price list, or the first one not deleted if
+// the ID is zero.
+func CatalogItems(ctx context.Context, master *agora.Master, catalog *sinli.Catalog, priceListID int) (*CatalogReport, error) {
+	priceList, err := pickPriceList(master.PriceLists, priceListID)
+	if err != nil {
+		return nil, err
+	}
+
+	products := map[string]agora.Product{}
+	for _, p := range master.Products {
+		if p.DeletionDate != "" {
+			continue
+		}
+		products[p.Barcode()] = p
+	}
+
+	report := &CatalogReport{
+		Products:     []CatalogProduct{},
+		PriceChanges: []CatalogPriceChange{},
+	}
+	seen := map[string]struct{}{}
+	for _, book := range catalog.Books {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		barcode := strings.ReplaceAll(strings.TrimSpace(book.ISBN), "-", "")
+		if barcode == "" {
+			barcode = strings.TrimSpace(book.EAN)
+		}
+		if barcode == "" {
+			log.Println("❌ no barcode for", book.Title)
+			continue
+		}
+		if _, ok := seen[barcode]; ok {
+			continue
+		}
+		seen[barcode] = struct{}{}
+
+		vat, err := pickVat(master.Vats, book.VATRate)
+		if err != nil {
+			return nil, err
+		}
+		price := catalogPrice(book, priceList, vat)
+
+		p, ok := products[barcode]
+		if !ok {
+			report.Products = append(report.Products, CatalogProduct{
+				Name:        strings.TrimSpace(book.Title),
+				Barcode:     barcode,
+				PriceListID: priceList.ID,
+				Price:       price,
+				VatID:       vat.ID,
+			})
+			continue
+		}
+		for _, pr := range p.Prices {
+			if pr.PriceListID != priceList.ID {
+				continue
+			}
+			if pr.Price.Round() == price.Round() {
+				continue
+			}
+			report.PriceChanges = append(report.PriceChanges, CatalogPriceChange{
+				ProductID:   p.ID,
+				Name:        p.Name,
+				Barcode:     barcode,
+				PriceListID: priceList.ID,
+				OldPrice:    pr.Price,
+				NewPrice:    price,
+			})
+		}
+	}
+
+	// Sort by barcode to be deterministic
+	sort.Slice(report.Products, func(i, j int) bool {
+		return report.Products[i].Barcode < report.Products[j].Barcode
+	})
+	sort.Slice(report.PriceChanges, func(i, j int) bool {
+		return report.PriceChanges[i].Barcode < report.PriceChanges[j].Barcode
+	})
+	return report, nil
+}
+
+// pickPriceList returns the price list with the ID, or the first one not
+// deleted if the ID is zero.
+func pickPriceList(priceLists []agora.PriceList, id int) (agora.PriceList, error) {
+	for _, pl := range priceLists {
+		if pl.DeletionDate != "" {
+			continue
+		}
+		if id == 0 || pl.ID == id {
+			return pl, nil
+		}
+	}
+	if id != 0 {
+		return agora.PriceList{}, fmt.Errorf("price list %d not found", id)
+	}
+	return agora.PriceList{}, errors.New("no price lists found")
+}
+
+// pickVat returns the enabled vat closest to the given rate percentage.
+func pickVat(vats []agora.Vat, rate float32) (agora.Vat, error) {
+	var best agora.Vat
+	var found bool
+	bestDiff := math.Inf(1)
+	for _, vat := range vats {
+		if !vat.Enabled {
+			continue
+		}
+		diff := math.Abs(float64(vat.VatRate*100 - rate))
+		if diff < bestDiff {
+			best = vat
+			bestDiff = diff
+			found = true
+		}
+	}
+	if !found {
+		return agora.Vat{}, errors.New("no enabled vats found")
+	}
+	return best, nil
+}
+
+// catalogPrice returns the price of the book for the price list, with or
+// without VAT.
+func catalogPrice(book sinli.CatalogBook, priceList agora.PriceList, vat agora.Vat) money.Amount {
+	if priceList.VatIncluded {
+		if book.PriceWithVAT != 0 {
+			return book.PriceWithVAT
+		}
+		// Add VAT to price
+		return book.PriceWithoutVAT.WithVAT(float64(vat.VatRate))
+	}
+	if book.PriceWithoutVAT != 0 {
+		return book.PriceWithoutVAT
+	}
+	// Remove VAT from price
+	return book.PriceWithVAT.WithoutVAT(float64(vat.VatRate))
+}
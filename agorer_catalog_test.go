@@ -0,0 +1,125 @@
+package agorer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/igolaizola/agorer/pkg/agora"
+	"github.com/igolaizola/agorer/pkg/money"
+	"github.com/igolaizola/agorer/pkg/sinli"
+)
+
+func TestPickPriceList(t *testing.T) {
+	priceLists := []agora.PriceList{
+		{ID: 1, Name: "Old", DeletionDate: "2022-01-01T00:00:00"},
+		{ID: 2, Name: "Tarifa", VatIncluded: true},
+		{ID: 3, Name: "Mayorista"},
+	}
+	tests := []struct {
+		name    string
+		lists   []agora.PriceList
+		id      int
+		want    int
+		wantErr bool
+	}{
+		{name: "first not deleted", lists: priceLists, want: 2},
+		{name: "configured", lists: priceLists, id: 3, want: 3},
+		{name: "configured deleted", lists: priceLists, id: 1, wantErr: true},
+		{name: "configured missing", lists: priceLists, id: 9, wantErr: true},
+		{name: "none", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pickPriceList(tt.lists, tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %t, got %v", tt.wantErr, err)
+			}
+			if got.ID != tt.want {
+				t.Fatalf("want %d, got %d", tt.want, got.ID)
+			}
+		})
+	}
+}
+
+func TestPickVat(t *testing.T) {
+	vats := []agora.Vat{
+		{ID: 1, VatRate: 0.04, Enabled: true},
+		{ID: 2, VatRate: 0.1, Enabled: false},
+		{ID: 3, VatRate: 0.21, Enabled: true},
+	}
+	tests := []struct {
+		name    string
+		vats    []agora.Vat
+		rate    float32
+		want    int
+		wantErr bool
+	}{
+		{name: "exact", vats: vats, rate: 4, want: 1},
+		{name: "closest enabled", vats: vats, rate: 10, want: 1},
+		{name: "general", vats: vats, rate: 21, want: 3},
+		{name: "none enabled", vats: []agora.Vat{{ID: 1, VatRate: 0.04}}, rate: 4, wantErr: true},
+		{name: "none", rate: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pickVat(tt.vats, tt.rate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %t, got %v", tt.wantErr, err)
+			}
+			if got.ID != tt.want {
+				t.Fatalf("want %d, got %d", tt.want, got.ID)
+			}
+		})
+	}
+}
+
+func TestCatalogItems(t *testing.T) {
+	master := &agora.Master{
+		Vats: []agora.Vat{{ID: 1, VatRate: 0.04, Enabled: true}},
+		PriceLists: []agora.PriceList{
+			{ID: 1, DeletionDate: "2022-01-01T00:00:00"},
+			{ID: 2, VatIncluded: true},
+		},
+		Products: []agora.Product{
+			{
+				ID: 1, Name: "V for Vendetta",
+				Barcodes: []agora.ProductBarcode{{Value: "9781779511195"}},
+				Prices:   []agora.ProductPrice{{PriceListID: 1, Price: money.New(1)}, {PriceListID: 2, Price: money.New(20.8)}},
+			},
+			{
+				ID: 2, Name: "Binti",
+				Barcodes: []agora.ProductBarcode{{Value: "9788494795886"}},
+				Prices:   []agora.ProductPrice{{PriceListID: 2, Price: money.New(15)}},
+			},
+		},
+	}
+	catalog := &sinli.Catalog{
+		Books: []sinli.CatalogBook{
+			{ISBN: "978-1-77951-119-5", Title: "V for Vendetta", PriceWithVAT: money.New(20.8), VATRate: 4},
+			{ISBN: "978-84-947958-8-6", Title: "Binti", PriceWithoutVAT: money.New(15), VATRate: 4},
+			{ISBN: "978-84-18054-52-5", Title: "El último minuto ", PriceWithVAT: money.New(10.4), VATRate: 4},
+		},
+	}
+	got, err := CatalogItems(context.Background(), master, catalog, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CatalogReport{
+		Products: []CatalogProduct{
+			{Name: "El último minuto", Barcode: "9788418054525", PriceListID: 2, Price: money.New(10.4), VatID: 1},
+		},
+		PriceChanges: []CatalogPriceChange{
+			{ProductID: 2, Name: "Binti", Barcode: "9788494795886", PriceListID: 2, OldPrice: money.New(15), NewPrice: money.New(15.6)},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want:\n%+v\ngot:\n%+v", want, got)
+	}
+
+	// Catalogs can't be compared without enabled vats
+	master.Vats[0].Enabled = false
+	if _, err := CatalogItems(context.Background(), master, catalog, 0); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
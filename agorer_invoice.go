@@ -0,0 +1,231 @@
+package agorer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/agora"
+	"github.com/igolaizola/agorer/pkg/money"
+	"github.com/igolaizola/agorer/pkg/sinli"
+)
+
+// Invoice parses a sinli supplier invoice and generates a summary of the cost
+// prices of each ISBN, flagging the ones that differ from agora.
+func Invoice(ctx context.Context, c *Config, file string) error {
+	// Validate config
+	if file == "" {
+		return errors.New("invoice file must be provided")
+	}
+	if c.Input == "" {
+		return errors.New("input must be provided")
+	}
+	if c.LogDir == "" {
+		return errors.New("log dir must be provided")
+	}
+	output := c.Output
+	switch c.OutputType {
+	case "json", "csv":
+		if output == "" {
+			output = filepath.Join(c.LogDir, fmt.Sprintf("invoice_%s.%s", time.Now().Format("20060102_150405"), c.OutputType))
+		}
+	default:
+		return fmt.Errorf("invalid output type %s", c.OutputType)
+	}
+
+	// Create log dir if it doesn't exist
+	if err := os.MkdirAll(c.LogDir, 0755); err != nil {
+		return fmt.Errorf("couldn't create log dir %s: %w", c.LogDir, err)
+	}
+
+	// Read sinli invoice
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("couldn't read file %s: %w", file, err)
+	}
+	var invoice sinli.Invoice
+	if err := sinli.Unmarshal(b, &invoice); err != nil {
+		return fmt.Errorf("couldn't unmarshal sinli invoice: %w", err)
+	}
+	if doc := invoice.IdentificationHeader.Document; doc != sinli.FileTypeInvoice {
+		return fmt.Errorf("invalid document type %s, expected %s", doc, sinli.FileTypeInvoice)
+	}
+
+	s, _, err := loadStore(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	items, err := InvoiceItems(ctx, s, &invoice)
+	if err != nil {
+		return fmt.Errorf("couldn't generate invoice summary: %w", err)
+	}
+
+	if c.OutputType == "json" {
+		// Write summary to json file
+		b, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return fmt.Errorf("couldn't marshal json: %w", err)
+		}
+		if err := os.WriteFile(output, b, 0644); err != nil {
+			return fmt.Errorf("couldn't write file %s: %w", output, err)
+		}
+		return nil
+	}
+
+	// Write summary to csv file
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("couldn't create file %s: %w", output, err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{"isbn", "title", "product_id", "quantity", "price_without_vat", "discount", "cost_price", "amount", "agora_cost_prices", "discrepancy"})
+	for _, item := range items {
+		var agoraCosts []string
+		for _, cost := range item.AgoraCostPrices {
+			agoraCosts = append(agoraCosts, cost.String())
+		}
+		_ = w.Write([]string{
+			item.ISBN,
+			item.Title,
+			strconv.Itoa(item.ProductID),
+			strconv.Itoa(item.Quantity),
+			item.PriceWithoutVAT.String(),
+			formatFloat(item.Discount),
+			item.CostPrice.String(),
+			item.Amount.String(),
+			strings.Join(agoraCosts, " "),
+			strconv.FormatBool(item.Discrepancy),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("couldn't write file %s: %w", output, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("couldn't close file %s: %w", output, err)
+	}
+	return nil
+}
+
+type InvoiceItem struct {
+	ISBN  string `json:"isbn"`
+	Title string `json:"title"`
+	// Zero if the ISBN isn't found in agora
+	ProductID       int          `json:"product_id"`
+	Quantity        int          `json:"quantity"`
+	PriceWithoutVAT money.Amount `json:"price_without_vat"`
+	Discount        float32      `json:"discount"`
+	// Unit cost price after applying the discount
+	CostPrice money.Amount `json:"cost_price"`
+	Amount    money.Amount `json:"amount"`
+	// Product cost price followed by warehouse cost prices, unset (zero)
+	// ones are left out
+	AgoraCostPrices []money.Amount `json:"agora_cost_prices"`
+	Discrepancy     bool           `json:"discrepancy"`
+}
+
+// InvoiceItems groups the invoice details by ISBN, price and discount and
+// compares their cost prices with the agora product cost prices.
+func InvoiceItems(ctx context.Context, s *Store, inv *sinli.Invoice) ([]InvoiceItem, error) {
+	type itemKey struct {
+		code     string
+		price    money.Amount
+		discount float32
+	}
+	items := map[itemKey]*InvoiceItem{}
+	for _, detail := range inv.Details {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		code := strings.TrimSpace(detail.ISBN)
+		if code == "" {
+			code = strings.TrimSpace(detail.EAN)
+		}
+		amount := detail.NetAmount
+		if amount == 0 {
+			amount = detail.PriceWithoutVAT.MulRate(1 - float64(detail.Discount)/100).Mul(detail.Quantity)
+		}
+		key := itemKey{code: code, price: detail.PriceWithoutVAT, discount: detail.Discount}
+		item, ok := items[key]
+		if !ok {
+			item = &InvoiceItem{
+				ISBN:            code,
+				Title:           detail.Title,
+				PriceWithoutVAT: detail.PriceWithoutVAT,
+				Discount:        detail.Discount,
+			}
+			items[key] = item
+		}
+		item.Quantity += detail.Quantity
+		item.Amount += amount
+	}
+
+	var summary []InvoiceItem
+	for _, item := range items {
+		if item.Quantity != 0 {
+			item.CostPrice = item.Amount.Div(item.Quantity)
+		}
+		p, ok := s.Book(item.ISBN)
+		if ok {
+			item.ProductID = p.ID
+			item.AgoraCostPrices, item.Discrepancy = compareCostPrices(p, item.CostPrice)
+		}
+		summary = append(summary, *item)
+	}
+
+	// Sort items by ISBN, price and discount to be deterministic
+	sort.Slice(summary, func(i, j int) bool {
+		a, b := summary[i], summary[j]
+		if a.ISBN != b.ISBN {
+			return a.ISBN < b.ISBN
+		}
+		if a.PriceWithoutVAT != b.PriceWithoutVAT {
+			return a.PriceWithoutVAT < b.PriceWithoutVAT
+		}
+		return a.Discount < b.Discount
+	})
+	return summary, nil
+}
+
+// compareCostPrices returns the cost prices set in the product and its
+// warehouses and whether none of them matches the given cost price once
+// rounded to cents.
+// Warehouses may have different cost prices, so matching any of them is
+// enough, and there is no discrepancy if no cost price is set.
+func compareCostPrices(p agora.Product, cost money.Amount) ([]money.Amount, bool) {
+	var costs []money.Amount
+	if p.CostPrice != 0 {
+		costs = append(costs, p.CostPrice)
+	}
+	for _, cp := range p.CostPrices {
+		if cp.CostPrice != 0 {
+			costs = append(costs, cp.CostPrice)
+		}
+	}
+	if len(costs) == 0 {
+		return nil, false
+	}
+	for _, c := range costs {
+		if c.Round() == cost.Round() {
+			return costs, false
+		}
+	}
+	return costs, true
+}
+
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', 2, 32)
+}
@@ -0,0 +1,118 @@
+package agorer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/igolaizola/agorer/pkg/agora"
+	"github.com/igolaizola/agorer/pkg/money"
+	"github.com/igolaizola/agorer/pkg/sinli"
+)
+
+func TestCompareCostPrices(t *testing.T) {
+	tests := []struct {
+		name        string
+		product     agora.Product
+		cost        money.Amount
+		costs       []money.Amount
+		discrepancy bool
+	}{
+		{
+			name:    "no cost prices",
+			product: agora.Product{},
+			cost:    money.New(7.5),
+		},
+		{
+			name:    "product cost price",
+			product: agora.Product{CostPrice: money.New(7.5)},
+			cost:    money.New(7.4999),
+			costs:   []money.Amount{money.New(7.5)},
+		},
+		{
+			name:        "different cost price",
+			product:     agora.Product{CostPrice: money.New(7.5)},
+			cost:        money.New(8),
+			costs:       []money.Amount{money.New(7.5)},
+			discrepancy: true,
+		},
+		{
+			name: "unset product cost price",
+			product: agora.Product{CostPrices: []agora.ProductCostPrice{
+				{WarehouseID: 1, CostPrice: money.New(7.5)},
+			}},
+			cost:  money.New(7.5),
+			costs: []money.Amount{money.New(7.5)},
+		},
+		{
+			name: "warehouses with different cost prices",
+			product: agora.Product{CostPrice: money.New(7), CostPrices: []agora.ProductCostPrice{
+				{WarehouseID: 1, CostPrice: money.New(7)},
+				{WarehouseID: 2, CostPrice: money.New(7.5)},
+				{WarehouseID: 3},
+			}},
+			cost:  money.New(7.5),
+			costs: []money.Amount{money.New(7), money.New(7), money.New(7.5)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			costs, discrepancy := compareCostPrices(tt.product, tt.cost)
+			if !reflect.DeepEqual(costs, tt.costs) {
+				t.Errorf("want costs %v, got %v", tt.costs, costs)
+			}
+			if discrepancy != tt.discrepancy {
+				t.Errorf("want discrepancy %t, got %t", tt.discrepancy, discrepancy)
+			}
+		})
+	}
+}
+
+func TestInvoiceItems(t *testing.T) {
+	s := &Store{
+		Books: map[int]agora.Product{
+			1: {ID: 1, CostPrice: money.New(7.5)},
+			2: {ID: 2},
+		},
+		ISBNIndex: map[string]int{
+			"9781779511195": 1,
+			"9788494795886": 2,
+		},
+	}
+	inv := &sinli.Invoice{
+		Details: []sinli.InvoiceDetail{
+			{ISBN: "978-1-77951-119-5", Quantity: 2, PriceWithoutVAT: money.New(10), Discount: 25},
+			{ISBN: "978-1-77951-119-5", Quantity: 1, PriceWithoutVAT: money.New(10), Discount: 25},
+			{ISBN: "978-1-77951-119-5", Quantity: 1, PriceWithoutVAT: money.New(10), Discount: 30},
+			{ISBN: "978-84-947958-8-6", Quantity: 1, PriceWithoutVAT: money.New(20), NetAmount: money.New(12)},
+			{EAN: "9780000000002", Quantity: 1, PriceWithoutVAT: money.New(5)},
+		},
+	}
+	got, err := InvoiceItems(context.Background(), s, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InvoiceItem{
+		{
+			ISBN: "978-1-77951-119-5", ProductID: 1, Quantity: 3, PriceWithoutVAT: money.New(10), Discount: 25,
+			CostPrice: money.New(7.5), Amount: money.New(22.5),
+			AgoraCostPrices: []money.Amount{money.New(7.5)},
+		},
+		{
+			ISBN: "978-1-77951-119-5", ProductID: 1, Quantity: 1, PriceWithoutVAT: money.New(10), Discount: 30,
+			CostPrice: money.New(7), Amount: money.New(7),
+			AgoraCostPrices: []money.Amount{money.New(7.5)}, Discrepancy: true,
+		},
+		{
+			ISBN: "978-84-947958-8-6", ProductID: 2, Quantity: 1, PriceWithoutVAT: money.New(20),
+			CostPrice: money.New(12), Amount: money.New(12),
+		},
+		{
+			ISBN: "9780000000002", Quantity: 1, PriceWithoutVAT: money.New(5),
+			CostPrice: money.New(5), Amount: money.New(5),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want:\n%+v\ngot:\n%+v", want, got)
+	}
+}
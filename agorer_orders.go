@@ -2,8 +2,10 @@ package agorer
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"strconv"
 
 	"github.com/igolaizola/agorer/pkg/agora"
@@ -38,7 +40,7 @@ func OrderDetails(ctx context.Context, s *Store, inv *agora.Invoice) ([]sinli.Or
 				vat := s.Vats[p.VatID]
 				rate := vat.VatRate
 				// Add VAT to price
-				price = price * (1 + rate)
+				price = price.WithVAT(float64(rate))
 			}
 			details = append(details, sinli.OrderDetail{
 				ISBN:         isbnCode,
@@ -54,3 +56,42 @@ func OrderDetails(ctx context.Context, s *Store, inv *agora.Invoice) ([]sinli.Or
 	}
 	return details, nil
 }
+
+// DeliveryPoint is the address where the orders of a workplace are shipped.
+type DeliveryPoint struct {
+	Name       string `json:"name"`
+	Address    string `json:"address"`
+	PostalCode string `json:"postal_code"`
+	City       string `json:"city"`
+	Province   string `json:"province"`
+}
+
+// LoadDeliveryPoints reads the delivery points of each agora workplace ID
+// from a json file.
+func LoadDeliveryPoints(file string) (map[int]DeliveryPoint, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read file %s: %w", file, err)
+	}
+	points := map[int]DeliveryPoint{}
+	if err := json.Unmarshal(b, &points); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal delivery points: %w", err)
+	}
+	return points, nil
+}
+
+// OrderDeliveryPoint returns the delivery point of the invoice workplace, or
+// nil if there isn't one so the client default address is used.
+func OrderDeliveryPoint(points map[int]DeliveryPoint, inv *agora.Invoice) *sinli.OrderDeliveryPoint {
+	p, ok := points[inv.Workplace.ID]
+	if !ok {
+		return nil
+	}
+	return &sinli.OrderDeliveryPoint{
+		Name:       p.Name,
+		Address:    p.Address,
+		PostalCode: p.PostalCode,
+		City:       p.City,
+		Province:   p.Province,
+	}
+}
@@ -0,0 +1,158 @@
+package agorer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/sinli"
+)
+
+// Receive parses a sinli delivery note and generates a receiving report with
+// the quantities received of each agora product.
+func Receive(ctx context.Context, c *Config, file string) error {
+	// Validate config
+	if file == "" {
+		return errors.New("delivery file must be provided")
+	}
+	if c.Input == "" {
+		return errors.New("input must be provided")
+	}
+	if c.LogDir == "" {
+		return errors.New("log dir must be provided")
+	}
+	output := c.Output
+	if output == "" {
+		output = filepath.Join(c.LogDir, fmt.Sprintf("receive_%s.json", time.Now().Format("20060102_150405")))
+	}
+
+	// Create log dir if it doesn't exist
+	if err := os.MkdirAll(c.LogDir, 0755); err != nil {
+		return fmt.Errorf("couldn't create log dir %s: %w", c.LogDir, err)
+	}
+
+	// Read sinli delivery note
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("couldn't read file %s: %w", file, err)
+	}
+	var delivery sinli.Delivery
+	if err := sinli.Unmarshal(b, &delivery); err != nil {
+		return fmt.Errorf("couldn't unmarshal sinli delivery: %w", err)
+	}
+	if doc := delivery.IdentificationHeader.Document; doc != sinli.FileTypeDelivery {
+		return fmt.Errorf("invalid document type %s, expected %s", doc, sinli.FileTypeDelivery)
+	}
+
+	s, _, err := loadStore(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	report, err := ReceiveItems(ctx, s, &delivery)
+	if err != nil {
+		return fmt.Errorf("couldn't generate receiving report: %w", err)
+	}
+
+	// Write report to json file
+	b, err = json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal json: %w", err)
+	}
+	if err := os.WriteFile(output, b, 0644); err != nil {
+		return fmt.Errorf("couldn't write file %s: %w", output, err)
+	}
+	return nil
+}
+
+type ReceiveReport struct {
+	DeliveryNumber string           `json:"delivery_number"`
+	DeliveryDate   time.Time        `json:"delivery_date"`
+	ProviderName   string           `json:"provider_name"`
+	Items          []ReceiveItem    `json:"items"`
+	Unknown        []ReceiveUnknown `json:"unknown"`
+}
+
+type ReceiveItem struct {
+	ProductID int    `json:"product_id"`
+	Name      string `json:"name"`
+	ISBN      string `json:"isbn"`
+	Quantity  int    `json:"quantity"`
+}
+
+type ReceiveUnknown struct {
+	ISBN     string `json:"isbn"`
+	Title    string `json:"title"`
+	Quantity int    `json:"quantity"`
+}
+
+// ReceiveItems matches the delivery details with the store books and adds up
+// the quantities received of each one.
+func ReceiveItems(ctx context.Context, s *Store, d *sinli.Delivery) (*ReceiveReport, error) {
+	items := map[int]*ReceiveItem{}
+	unknown := map[string]*ReceiveUnknown{}
+	for _, detail := range d.Details {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		p, ok := s.Book(detail.ISBN)
+		if !ok && len(detail.EAN) >= 13 {
+			// EAN codes may be followed by an extension
+			p, ok = s.Book(detail.EAN[:13])
+		}
+		if !ok {
+			code := strings.TrimSpace(detail.ISBN)
+			if code == "" {
+				code = strings.TrimSpace(detail.EAN)
+			}
+			if _, ok := unknown[code]; !ok {
+				unknown[code] = &ReceiveUnknown{
+					ISBN:  code,
+					Title: detail.Title,
+				}
+			}
+			unknown[code].Quantity += detail.Quantity
+			continue
+		}
+		if _, ok := items[p.ID]; !ok {
+			items[p.ID] = &ReceiveItem{
+				ProductID: p.ID,
+				Name:      p.Name,
+				ISBN:      s.ISBNs[p.ID],
+			}
+		}
+		items[p.ID].Quantity += detail.Quantity
+	}
+
+	report := &ReceiveReport{
+		DeliveryNumber: d.Header.DeliveryNumber,
+		DeliveryDate:   d.Header.DeliveryDate,
+		ProviderName:   d.Header.ProviderName,
+		Items:          []ReceiveItem{},
+		Unknown:        []ReceiveUnknown{},
+	}
+	for _, item := range items {
+		report.Items = append(report.Items, *item)
+	}
+	for _, u := range unknown {
+		report.Unknown = append(report.Unknown, *u)
+	}
+
+	// Sort items by ISBN to be deterministic
+	sort.Slice(report.Items, func(i, j int) bool {
+		return report.Items[i].ISBN < report.Items[j].ISBN
+	})
+	sort.Slice(report.Unknown, func(i, j int) bool {
+		return report.Unknown[i].ISBN < report.Unknown[j].ISBN
+	})
+	return report, nil
+}
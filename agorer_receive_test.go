@@ -0,0 +1,144 @@
+package agorer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/agora"
+	"github.com/igolaizola/agorer/pkg/sinli"
+)
+
+func TestReceiveItems(t *testing.T) {
+	s := &Store{
+		Books: map[int]agora.Product{
+			1: {ID: 1, Name: "Binti"},
+			2: {ID: 2, Name: "El último minuto"},
+		},
+		ISBNs: map[int]string{
+			1: "978-84-947958-8-6",
+			2: "978-84-18054-52-5",
+		},
+		ISBNIndex: map[string]int{
+			"9788494795886": 1,
+			"9788418054525": 2,
+		},
+	}
+	date := time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		details     []sinli.DeliveryDetail
+		wantItems   []ReceiveItem
+		wantUnknown []ReceiveUnknown
+	}{
+		{
+			name:        "empty",
+			wantItems:   []ReceiveItem{},
+			wantUnknown: []ReceiveUnknown{},
+		},
+		{
+			name: "isbn",
+			details: []sinli.DeliveryDetail{
+				{ISBN: "978-84-947958-8-6", Title: "BINTI", Quantity: 2},
+			},
+			wantItems: []ReceiveItem{
+				{ProductID: 1, Name: "Binti", ISBN: "978-84-947958-8-6", Quantity: 2},
+			},
+			wantUnknown: []ReceiveUnknown{},
+		},
+		{
+			name: "ean",
+			details: []sinli.DeliveryDetail{
+				{EAN: "9788494795886", Title: "BINTI", Quantity: 1},
+			},
+			wantItems: []ReceiveItem{
+				{ProductID: 1, Name: "Binti", ISBN: "978-84-947958-8-6", Quantity: 1},
+			},
+			wantUnknown: []ReceiveUnknown{},
+		},
+		{
+			name: "ean with extension",
+			details: []sinli.DeliveryDetail{
+				{EAN: "978841805452590000", Title: "EL ULTIMO MINUTO", Quantity: 3},
+			},
+			wantItems: []ReceiveItem{
+				{ProductID: 2, Name: "El último minuto", ISBN: "978-84-18054-52-5", Quantity: 3},
+			},
+			wantUnknown: []ReceiveUnknown{},
+		},
+		{
+			name: "unknown isbn matched by ean",
+			details: []sinli.DeliveryDetail{
+				{ISBN: "978-1-77951-119-5", EAN: "9788494795886", Title: "BINTI", Quantity: 1},
+			},
+			wantItems: []ReceiveItem{
+				{ProductID: 1, Name: "Binti", ISBN: "978-84-947958-8-6", Quantity: 1},
+			},
+			wantUnknown: []ReceiveUnknown{},
+		},
+		{
+			name: "unknown",
+			details: []sinli.DeliveryDetail{
+				{ISBN: "978-1-77951-119-5", EAN: "9781779511195", Title: "V FOR VENDETTA", Quantity: 1},
+				{EAN: "8412345678905", Title: "MUG", Quantity: 2},
+				{EAN: "12345", Title: "SHORT", Quantity: 1},
+			},
+			wantItems: []ReceiveItem{},
+			wantUnknown: []ReceiveUnknown{
+				{ISBN: "12345", Title: "SHORT", Quantity: 1},
+				{ISBN: "8412345678905", Title: "MUG", Quantity: 2},
+				{ISBN: "978-1-77951-119-5", Title: "V FOR VENDETTA", Quantity: 1},
+			},
+		},
+		{
+			name: "repeated codes",
+			details: []sinli.DeliveryDetail{
+				{ISBN: "978-84-18054-52-5", Title: "EL ULTIMO MINUTO", Quantity: 1},
+				{ISBN: "978-84-947958-8-6", Title: "BINTI", Quantity: 2},
+				{EAN: "9788494795886", Title: "BINTI", Quantity: 3},
+				{ISBN: "978-1-77951-119-5", Title: "V FOR VENDETTA", Quantity: 1},
+				{ISBN: "978-1-77951-119-5", Title: "V FOR VENDETTA", Quantity: 4},
+			},
+			wantItems: []ReceiveItem{
+				{ProductID: 2, Name: "El último minuto", ISBN: "978-84-18054-52-5", Quantity: 1},
+				{ProductID: 1, Name: "Binti", ISBN: "978-84-947958-8-6", Quantity: 5},
+			},
+			wantUnknown: []ReceiveUnknown{
+				{ISBN: "978-1-77951-119-5", Title: "V FOR VENDETTA", Quantity: 5},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &sinli.Delivery{
+				Header: sinli.DeliveryHeader{
+					ProviderName:   "DISTRIBUIDORA",
+					DeliveryNumber: "A-123",
+					DeliveryDate:   date,
+				},
+				Details: tt.details,
+			}
+			got, err := ReceiveItems(context.Background(), s, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.DeliveryNumber != "A-123" {
+				t.Errorf("want delivery number A-123, got %s", got.DeliveryNumber)
+			}
+			if !got.DeliveryDate.Equal(date) {
+				t.Errorf("want delivery date %s, got %s", date, got.DeliveryDate)
+			}
+			if got.ProviderName != "DISTRIBUIDORA" {
+				t.Errorf("want provider DISTRIBUIDORA, got %s", got.ProviderName)
+			}
+			if !reflect.DeepEqual(got.Items, tt.wantItems) {
+				t.Errorf("want items:\n%+v\ngot:\n%+v", tt.wantItems, got.Items)
+			}
+			if !reflect.DeepEqual(got.Unknown, tt.wantUnknown) {
+				t.Errorf("want unknown:\n%+v\ngot:\n%+v", tt.wantUnknown, got.Unknown)
+			}
+		})
+	}
+}
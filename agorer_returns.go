@@ -39,12 +39,12 @@ func ReturnDetails(ctx context.Context, s *Store, inv *agora.Invoice) ([]sinli.R
 				vat := s.Vats[p.VatID]
 				rate := vat.VatRate
 				// Add VAT to price
-				priceWithVAT = priceWithVAT * (1 + rate)
+				priceWithVAT = priceWithVAT.WithVAT(float64(rate))
 			} else {
 				vat := s.Vats[p.VatID]
 				rate := vat.VatRate
 				// Remove VAT from price
-				priceWithoutVAT = priceWithoutVAT / (1 + rate)
+				priceWithoutVAT = priceWithoutVAT.WithoutVAT(float64(rate))
 			}
 			details = append(details, sinli.ReturnDetail{
 				ISBN:            isbnCode,
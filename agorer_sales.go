@@ -14,60 +14,62 @@ import (
 	"github.com/igolaizola/agorer/pkg/agora"
 	"github.com/igolaizola/agorer/pkg/isbn"
 	"github.com/igolaizola/agorer/pkg/mail"
+	"github.com/igolaizola/agorer/pkg/money"
 	"github.com/igolaizola/agorer/pkg/sinli"
 )
 
 func Sales(ctx context.Context, c *Config, day time.Time) error {
+	return SalesRange(ctx, c, day, day)
+}
+
+// SalesRange processes the sales of the days from one date to another, both
+// included.
+// JSON output is written to a file per day in the output directory when
+// there are several days, and sinli output is sent in a single file unless
+// daily files are configured.
+func SalesRange(ctx context.Context, c *Config, from, to time.Time) error {
 	// Validate config
-	input := c.Input
-	if input == "" {
+	if c.Input == "" && c.Agora == nil {
 		return errors.New("input must be provided")
 	}
 	if c.LogDir == "" {
 		return errors.New("log dir must be provided")
 	}
+	if to.Before(from) {
+		return fmt.Errorf("invalid range, %s is after %s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	var days []time.Time
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
 	// Validate input type
-	var agoraHost string
-	switch c.InputType {
-	case "agora":
-		if c.AgoraToken == "" {
-			return errors.New("agora token must be provided")
-		}
-		agoraHost = c.Input
-	case "agora-json":
-		port, err := agora.MockServe(ctx, ":0", c.Input)
+	var client agora.API
+	if c.Agora != nil || c.InputType != "json" {
+		a, err := c.agoraAPI(ctx)
 		if err != nil {
-			return fmt.Errorf("couldn't mock serve agora: %w", err)
-		}
-		agoraHost = fmt.Sprintf("http://localhost:%d", port)
-	case "json":
-		// Check if input is a directory
-		if fi, err := os.Stat(c.Input); err == nil && fi.IsDir() {
-			input = filepath.Join(input, fmt.Sprintf("%s.json", day.Format("2006-01-02")))
+			return err
 		}
-	default:
-		return fmt.Errorf("invalid input type %s", c.InputType)
+		client = a
 	}
-	if agoraHost != "" {
+	if client != nil {
 		if c.ISBNDir == "" {
 			return errors.New("isbn dir must be provided")
 		}
 	}
 
 	// Validate output type
-	output := c.Output
+	var format sinli.FormatType
+	var version sinli.FileVersion
 	switch c.OutputType {
 	case "json":
-		if output == "" {
-			output = filepath.Join(c.LogDir, fmt.Sprintf("sale_%s.json", time.Now().Format("20060102_150405")))
-		}
-		// Check if output is a directory
-		if fi, err := os.Stat(output); err == nil && fi.IsDir() {
-			output = filepath.Join(output, fmt.Sprintf("%s.json", day.Format("2006-01-02")))
-		}
 	case "sinli":
-		if output == "" {
-			output = filepath.Join(c.LogDir, fmt.Sprintf("sinli_N_%s_%s.snl", time.Now().Format("20060102_150405"), c.SINLISourceID))
+		f, err := c.sinliFormat()
+		if err != nil {
+			return err
+		}
+		format = f
+		if err := c.validateFallback(); err != nil {
+			return err
 		}
 		if c.SINLISourceEmail == "" {
 			return errors.New("sinli source email must be provided")
@@ -84,6 +86,11 @@ func Sales(ctx context.Context, c *Config, day time.Time) error {
 		if c.SINLIClientName == "" {
 			return errors.New("sinli client name must be provided")
 		}
+		v, err := c.sinliVersion(sinli.FileTypeSale, sinli.FileVersionSale)
+		if err != nil {
+			return err
+		}
+		version = v
 		if !c.Mail.Dry {
 			if c.Mail.Host == "" {
 				return errors.New("mail host must be provided")
@@ -109,13 +116,13 @@ func Sales(ctx context.Context, c *Config, day time.Time) error {
 		}
 	}
 
-	tickets := []SaleTicket{}
-	if agoraHost != "" {
-		// Export day data data from Agora
-		client := agora.New(agoraHost, c.AgoraToken, c.LogDir)
-		d, err := client.ExportDay(ctx, day)
+	// Tickets of each day
+	tickets := make([][]SaleTicket, len(days))
+	if client != nil {
+		// Export days data from Agora
+		exports, err := client.ExportDays(ctx, from, to)
 		if err != nil {
-			return fmt.Errorf("couldn't get day: %w", err)
+			return fmt.Errorf("couldn't get days: %w", err)
 		}
 
 		master, err := client.ExportMaster(ctx)
@@ -132,99 +139,211 @@ func Sales(ctx context.Context, c *Config, day time.Time) error {
 		// Create store using master data and isbn client
 		s := NewStore(ctx, master, isbnClient)
 
-		for _, inv := range d.Invoices {
-			date, err := time.Parse("2006-01-02T15:04:05", inv.Date)
+		for i, d := range exports {
+			ts, err := dayTickets(s, d)
 			if err != nil {
-				return fmt.Errorf("couldn't parse date %s: %w", inv.Date, err)
+				return err
 			}
-			var netAmount float32
-			ticket := SaleTicket{
-				SaleDate:   date,
-				SaleNumber: strconv.Itoa(inv.Number),
-			}
-			for _, item := range inv.InvoiceItems {
-				for _, line := range item.Lines {
-					isbnCode, ok := s.ISBNs[line.ProductID]
-					if !ok {
-						continue
-					}
-					priceWithVAT := float32(line.ProductPrice)
-					priceWithoutVAT := priceWithVAT / (1 + line.VatRate)
-					item := SaleItem{
-						Name:            line.ProductName,
-						ISBN:            isbnCode,
-						Quantity:        int(line.Quantity),
-						PriceWithoutVAT: priceWithoutVAT,
-					}
-					ticket.Items = append(ticket.Items, item)
-					netAmount += priceWithoutVAT * float32(line.Quantity)
-				}
-			}
-			if len(ticket.Items) == 0 {
-				continue
-			}
-			ticket.NetAmount = netAmount
-			tickets = append(tickets, ticket)
+			tickets[i] = ts
 		}
 	} else {
-		// Read stock from json file
-		b, err := os.ReadFile(input)
-		if err != nil {
-			return fmt.Errorf("couldn't read file %s: %w", input, err)
+		// Read tickets from a json file per day if the input is a directory
+		inputs := []string{c.Input}
+		if fi, err := os.Stat(c.Input); err == nil && fi.IsDir() {
+			inputs = nil
+			for _, day := range days {
+				inputs = append(inputs, filepath.Join(c.Input, fmt.Sprintf("%s.json", day.Format("2006-01-02"))))
+			}
+		} else if len(days) > 1 {
+			return errors.New("input must be a directory to read a range of days")
 		}
-		if err := json.Unmarshal(b, &tickets); err != nil {
-			return fmt.Errorf("couldn't unmarshal json: %w", err)
+		for i, input := range inputs {
+			b, err := os.ReadFile(input)
+			if err != nil {
+				return fmt.Errorf("couldn't read file %s: %w", input, err)
+			}
+			ts := []SaleTicket{}
+			if err := json.Unmarshal(b, &ts); err != nil {
+				return fmt.Errorf("couldn't unmarshal json: %w", err)
+			}
+			tickets[i] = ts
 		}
 	}
 
+	now := time.Now().Format("20060102_150405")
 	if c.OutputType == "json" {
-		// Write stock to json file
-		b, err := json.MarshalIndent(tickets, "", "  ")
-		if err != nil {
-			return fmt.Errorf("couldn't marshal json: %w", err)
+		for i, day := range days {
+			output, err := c.salesJSONOutput(day, len(days) > 1, now)
+			if err != nil {
+				return err
+			}
+			// Write tickets to json file
+			b, err := json.MarshalIndent(tickets[i], "", "  ")
+			if err != nil {
+				return fmt.Errorf("couldn't marshal json: %w", err)
+			}
+			if err := os.WriteFile(output, b, 0644); err != nil {
+				return fmt.Errorf("couldn't write file %s: %w", output, err)
+			}
 		}
-		if err := os.WriteFile(output, b, 0644); err != nil {
-			return fmt.Errorf("couldn't write file %s: %w", output, err)
+		return nil
+	}
+
+	if c.SINLIDaily && len(days) > 1 {
+		// Send a file for each day
+		for i, day := range days {
+			output := c.Output
+			if output == "" {
+				output = filepath.Join(c.LogDir, fmt.Sprintf("sinli_%s_%s_%s_%s.snl", format, day.Format("20060102"), now, c.SINLISourceID))
+			} else {
+				output = suffixOutput(output, day.Format("2006-01-02"))
+			}
+			if err := c.sendSales(ctx, tickets[i], day, format, version, output); err != nil {
+				return err
+			}
 		}
 		return nil
 	}
 
-	// Generate sinli stock
-	sinliTickets, err := SaleTickets(ctx, tickets)
-	if err != nil {
-		return fmt.Errorf("couldn't generate stock: %w", err)
+	// Send a single file with all the days
+	output := c.Output
+	if output == "" {
+		output = filepath.Join(c.LogDir, fmt.Sprintf("sinli_%s_%s_%s.snl", format, now, c.SINLISourceID))
+	}
+	var all []SaleTicket
+	for _, ts := range tickets {
+		all = append(all, ts...)
 	}
+	return c.sendSales(ctx, all, to, format, version, output)
+}
 
-	// Create sinli stock
-	stock := sinli.Sale{
-		IdentificationHeader: sinli.IdentificationHeader{
-			Format:        sinli.FormatTypeNormalized,
-			Document:      sinli.FileTypeSale,
-			Version:       sinli.FileVersionSale,
-			SourceID:      c.SINLISourceID,
-			DestinationID: c.SINLIDestinationID,
-		},
-		Identification: sinli.Identification{
-			SourceEmail:      c.SINLISourceEmail,
-			DestinationEmail: c.SINLIDestinationEmail,
-			FileType:         sinli.FileTypeStock,
-			FileVersion:      sinli.FileVersionStock,
-		},
-		Header: sinli.SaleHeader{
-			ClientName:   c.SINLIClientName,
-			DispatchDate: day,
-			Coin:         sinli.CoinEuro,
-		},
-		Tickets: sinliTickets,
+// salesJSONOutput returns the json file of the day, which is inside the
+// output directory when there are several days.
+func (c *Config) salesJSONOutput(day time.Time, several bool, now string) (string, error) {
+	output := c.Output
+	dayFile := fmt.Sprintf("%s.json", day.Format("2006-01-02"))
+	if several {
+		if output == "" {
+			output = c.LogDir
+		}
+		if err := os.MkdirAll(output, 0755); err != nil {
+			return "", fmt.Errorf("couldn't create output dir %s: %w", output, err)
+		}
+		return filepath.Join(output, dayFile), nil
 	}
+	if output == "" {
+		output = filepath.Join(c.LogDir, fmt.Sprintf("sale_%s.json", now))
+	}
+	// Check if output is a directory
+	if fi, err := os.Stat(output); err == nil && fi.IsDir() {
+		output = filepath.Join(output, dayFile)
+	}
+	return output, nil
+}
 
-	// Write sinli stock to output
-	b, err := sinli.Marshal(stock)
+// dayTickets returns the tickets of the invoices of the day with books.
+func dayTickets(s *Store, d *agora.Day) ([]SaleTicket, error) {
+	tickets := []SaleTicket{}
+	for _, inv := range d.Invoices {
+		if inv.Date.IsZero() {
+			return nil, fmt.Errorf("missing date of invoice %d", inv.Number)
+		}
+		var netAmount money.Amount
+		ticket := SaleTicket{
+			SaleDate:   inv.Date.Time,
+			SaleNumber: strconv.Itoa(inv.Number),
+		}
+		for _, item := range inv.InvoiceItems {
+			for _, line := range item.Lines {
+				isbnCode, ok := s.ISBNs[line.ProductID]
+				if !ok {
+					continue
+				}
+				priceWithoutVAT := line.ProductPrice.WithoutVAT(float64(line.VatRate))
+				item := SaleItem{
+					Name:            line.ProductName,
+					ISBN:            isbnCode,
+					Quantity:        int(line.Quantity),
+					PriceWithoutVAT: priceWithoutVAT,
+				}
+				ticket.Items = append(ticket.Items, item)
+				netAmount += priceWithoutVAT.Mul(int(line.Quantity))
+			}
+		}
+		if len(ticket.Items) == 0 {
+			continue
+		}
+		ticket.NetAmount = netAmount
+		tickets = append(tickets, ticket)
+	}
+	return tickets, nil
+}
+
+// sendSales writes the tickets to a sinli file and sends it.
+func (c *Config) sendSales(ctx context.Context, tickets []SaleTicket, dispatch time.Time, format sinli.FormatType, version sinli.FileVersion, output string) error {
+	// Obtain the transmission number of the destination
+	transmissions, err := loadTransmissions(c.transmissionsFile())
 	if err != nil {
-		return fmt.Errorf("couldn't marshal sinli sale: %w", err)
+		return err
+	}
+	transmission := transmissions.next(c.SINLIDestinationID)
+
+	identificationHeader := sinli.IdentificationHeader{
+		Format:             format,
+		Document:           sinli.FileTypeSale,
+		Version:            version,
+		SourceID:           c.SINLISourceID,
+		DestinationID:      c.SINLIDestinationID,
+		TransmissionNumber: transmission,
+	}
+	identification := sinli.Identification{
+		SourceEmail:        c.SINLISourceEmail,
+		DestinationEmail:   c.SINLIDestinationEmail,
+		FileType:           sinli.FileTypeSale,
+		FileVersion:        version,
+		TransmissionNumber: transmission,
+	}
+	header := sinli.SaleHeader{
+		ClientName:   c.SINLIClientName,
+		DispatchDate: dispatch,
+		Coin:         sinli.CoinEuro,
+	}
+
+	// Create sinli sale using the layout of the version
+	var sale interface{}
+	switch version {
+	case sinli.FileVersionSaleV2:
+		details, err := SaleDetailsV2(ctx, tickets)
+		if err != nil {
+			return fmt.Errorf("couldn't generate sale: %w", err)
+		}
+		sale = sinli.SaleV2{
+			IdentificationHeader: identificationHeader,
+			Identification:       identification,
+			Header:               header,
+			Details:              details,
+		}
+	default:
+		sinliTickets, err := SaleTickets(ctx, tickets)
+		if err != nil {
+			return fmt.Errorf("couldn't generate sale: %w", err)
+		}
+		sale = sinli.Sale{
+			IdentificationHeader: identificationHeader,
+			Identification:       identification,
+			Header:               header,
+			Tickets:              sinliTickets,
+		}
 	}
-	if err := os.WriteFile(output, b, 0644); err != nil {
-		return fmt.Errorf("couldn't write file %s: %w", output, err)
+
+	// Write sinli sale to output
+	if err := c.writeSINLI(output, func(enc *sinli.Encoder) error {
+		if err := enc.Encode(sale); err != nil {
+			return fmt.Errorf("couldn't marshal sinli sale: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
 
 	// Marshal subject
@@ -232,33 +351,46 @@ func Sales(ctx context.Context, c *Config, day time.Time) error {
 		SourceID:      c.SINLISourceID,
 		DestinationID: c.SINLIDestinationID,
 		FileType:      sinli.FileTypeSale,
-		FileVersion:   sinli.FileVersionSale,
+		FileVersion:   version,
 	}
-	b, err = sinli.Marshal(sinliSubject)
+	b, err := sinli.Marshal(sinliSubject)
 	if err != nil {
 		return fmt.Errorf("couldn't marshal sinli subject: %w", err)
 	}
 	subject := strings.TrimSpace(string(b))
 
+	// Validate the file before sending it
+	if err := checkSINLI(output); err != nil {
+		return err
+	}
+
 	// Send email
 	if err := mail.Send(ctx, &c.Mail, c.SINLISourceEmail, c.SINLIDestinationEmail, subject, "", output); err != nil {
 		return fmt.Errorf("couldn't send email: %w", err)
 	}
+
+	// Save the transmission number once the file has been sent
+	if !c.Mail.Dry {
+		if err := transmissions.save(c.SINLIDestinationID, transmission); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 type SaleTicket struct {
-	SaleDate   time.Time  `json:"sale_date"`
-	SaleNumber string     `json:"sale_number"`
-	NetAmount  float32    `json:"net_amount"`
-	Items      []SaleItem `json:"items"`
+	SaleDate   time.Time    `json:"sale_date"`
+	SaleNumber string       `json:"sale_number"`
+	NetAmount  money.Amount `json:"net_amount"`
+	Items      []SaleItem   `json:"items"`
 }
 
 type SaleItem struct {
-	Name            string  `json:"name"`
-	ISBN            string  `json:"isbn"`
-	Quantity        int     `json:"quantity"`
-	PriceWithoutVAT float32 `json:"price_without_vat"`
+	// Empty if read from a sinli file
+	Name            string       `json:"name,omitempty"`
+	ISBN            string       `json:"isbn"`
+	Quantity        int          `json:"quantity"`
+	PriceWithoutVAT money.Amount `json:"price_without_vat"`
 }
 
 func SaleTickets(ctx context.Context, ts []SaleTicket) ([]sinli.SaleTicket, error) {
@@ -280,3 +412,20 @@ func SaleTickets(ctx context.Context, ts []SaleTicket) ([]sinli.SaleTicket, erro
 	}
 	return tickets, nil
 }
+
+// SaleDetailsV2 converts the tickets to sale details of the version 2 layout,
+// which has no ticket records.
+func SaleDetailsV2(ctx context.Context, ts []SaleTicket) ([]sinli.SaleDetailV2, error) {
+	var details []sinli.SaleDetailV2
+	for _, t := range ts {
+		for _, item := range t.Items {
+			details = append(details, sinli.SaleDetailV2{
+				SaleDate:        t.SaleDate,
+				ISBN:            item.ISBN,
+				Quantity:        item.Quantity,
+				PriceWithoutVAT: item.PriceWithoutVAT,
+			})
+		}
+	}
+	return details, nil
+}
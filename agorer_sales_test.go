@@ -0,0 +1,133 @@
+package agorer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/agora"
+	"github.com/igolaizola/agorer/pkg/money"
+)
+
+// fakeAgora is an agora API that returns the days and master data it holds.
+type fakeAgora struct {
+	days   map[string]*agora.Day
+	master *agora.Master
+}
+
+func (f *fakeAgora) ExportDay(ctx context.Context, date time.Time) (*agora.Day, error) {
+	day, ok := f.days[date.Format("2006-01-02")]
+	if !ok {
+		return nil, fmt.Errorf("day %s not found", date.Format("2006-01-02"))
+	}
+	return day, nil
+}
+
+func (f *fakeAgora) ExportDays(ctx context.Context, from, to time.Time) ([]*agora.Day, error) {
+	return agora.ExportDays(ctx, f, from, to, 1)
+}
+
+func (f *fakeAgora) ExportMaster(ctx context.Context, filters ...string) (*agora.Master, error) {
+	return f.master, nil
+}
+
+// testISBNDir returns a directory with the isbn cache of the codes, so they
+// aren't looked up online.
+func testISBNDir(t *testing.T, codes map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	b, err := json.Marshal(codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "isbn.json"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "isbn_err.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSalesAgora(t *testing.T) {
+	date := time.Date(2023, 2, 28, 10, 30, 0, 0, time.UTC)
+	line := func(productID, quantity int, price float64) agora.InvoiceItemLine {
+		return agora.InvoiceItemLine{
+			ProductID:    productID,
+			ProductName:  fmt.Sprintf("Product %d", productID),
+			ProductPrice: money.New(price),
+			VatRate:      0.04,
+			Quantity:     float32(quantity),
+		}
+	}
+	fake := &fakeAgora{
+		master: &agora.Master{
+			Vats: []agora.Vat{
+				{ID: 1, VatRate: 0.04, Enabled: true},
+				{ID: 2, VatRate: 0.21, Enabled: true},
+			},
+			Products: []agora.Product{
+				{ID: 1, Name: "Book", VatID: 1, Barcodes: []agora.ProductBarcode{{Value: "9788494795886"}}},
+				{ID: 2, Name: "Mug", VatID: 2, Barcodes: []agora.ProductBarcode{{Value: "8412345678905"}}},
+			},
+		},
+		days: map[string]*agora.Day{
+			"2023-02-28": {
+				Invoices: []agora.Invoice{
+					{Number: 12, Date: agora.Time{Time: date}, InvoiceItems: []agora.InvoiceItem{
+						{Lines: []agora.InvoiceItemLine{line(1, 2, 20.8), line(2, 1, 12.1)}},
+					}},
+					// Invoices without books are skipped
+					{Number: 13, Date: agora.Time{Time: date}, InvoiceItems: []agora.InvoiceItem{
+						{Lines: []agora.InvoiceItemLine{line(2, 1, 12.1)}},
+					}},
+				},
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "sales.json")
+	c := &Config{
+		Agora:      fake,
+		ISBNDir:    testISBNDir(t, map[string]string{"9788494795886": "978-84-947958-8-6"}),
+		LogDir:     dir,
+		OutputType: "json",
+		Output:     output,
+	}
+	if err := Sales(context.Background(), c, time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []SaleTicket
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []SaleTicket{
+		{
+			SaleDate:   date,
+			SaleNumber: "12",
+			NetAmount:  money.New(40),
+			Items: []SaleItem{
+				{Name: "Product 1", ISBN: "978-84-947958-8-6", Quantity: 2, PriceWithoutVAT: money.New(20)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want:\n%+v\ngot:\n%+v", want, got)
+	}
+
+	// Errors of the agora api are returned
+	if err := Sales(context.Background(), c, time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
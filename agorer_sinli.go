@@ -0,0 +1,454 @@
+package agorer
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/igolaizola/agorer/pkg/money"
+	"github.com/igolaizola/agorer/pkg/sinli"
+)
+
+// Validate checks a sinli file against the layout of its document and prints
+// the problems found.
+func Validate(ctx context.Context, file string) error {
+	problems, err := validateSINLI(file)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("sinli file %s has %d problems", file, len(problems))
+	}
+	fmt.Println("✅ sinli file is valid")
+	return nil
+}
+
+func validateSINLI(file string) ([]sinli.Problem, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open file %s: %w", file, err)
+	}
+	defer f.Close()
+	problems, err := sinli.Validate(f)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't validate file %s: %w", file, err)
+	}
+	return problems, nil
+}
+
+// checkSINLI validates a generated sinli file before sending it, logging the
+// problems found.
+func checkSINLI(file string) error {
+	problems, err := validateSINLI(file)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		log.Println("❌", p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("sinli file %s has %d problems", file, len(problems))
+	}
+	return nil
+}
+
+// Inspect prints each record of a sinli file with the names of its fields.
+func Inspect(ctx context.Context, file string) error {
+	doc, err := readSINLI(file)
+	if err != nil {
+		return err
+	}
+	records, err := sinli.Inspect(doc)
+	if err != nil {
+		return fmt.Errorf("couldn't inspect sinli file: %w", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, r := range records {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", i+1, r.Type, r.Path)
+		for _, f := range r.Fields {
+			fmt.Fprintf(w, "\t%s\t%s\n", f.Name, f.Value)
+		}
+	}
+	return w.Flush()
+}
+
+// Convert converts a sinli file to json or csv.
+// Stock and sale documents are converted to the same items generated by the
+// stock and sales commands, leaving out the fields the file doesn't carry,
+// and other documents are converted record by record.
+func Convert(ctx context.Context, file, to, output string) error {
+	if to != "json" && to != "csv" {
+		return fmt.Errorf("invalid output type %s", to)
+	}
+	doc, err := readSINLI(file)
+	if err != nil {
+		return err
+	}
+
+	// Write to stdout if no output is provided
+	w := io.Writer(os.Stdout)
+	var f *os.File
+	if output != "" {
+		f, err = os.Create(output)
+		if err != nil {
+			return fmt.Errorf("couldn't create file %s: %w", output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var v interface{}
+	var rows [][]string
+	switch d := doc.(type) {
+	case *sinli.Stock:
+		items := stockItems(d)
+		v = items
+		rows = append(rows, []string{"isbn", "quantity", "price_without_vat"})
+		for _, item := range items {
+			rows = append(rows, []string{
+				item.ISBN,
+				strconv.Itoa(item.Quantity),
+				item.PriceWithoutVAT.String(),
+			})
+		}
+	case *sinli.Sale, *sinli.SaleV2:
+		tickets := saleTickets(d)
+		v = tickets
+		rows = append(rows, []string{"sale_date", "sale_number", "net_amount", "isbn", "quantity", "price_without_vat"})
+		for _, t := range tickets {
+			for _, item := range t.Items {
+				rows = append(rows, []string{
+					t.SaleDate.Format("2006-01-02"),
+					t.SaleNumber,
+					t.NetAmount.String(),
+					item.ISBN,
+					strconv.Itoa(item.Quantity),
+					item.PriceWithoutVAT.String(),
+				})
+			}
+		}
+	default:
+		records, err := sinli.Inspect(doc)
+		if err != nil {
+			return fmt.Errorf("couldn't inspect sinli file: %w", err)
+		}
+		v = records
+		// Write a header row each time the record type changes
+		var last string
+		for _, r := range records {
+			if r.Type != last {
+				header := []string{"type"}
+				for _, f := range r.Fields {
+					header = append(header, f.Name)
+				}
+				rows = append(rows, header)
+				last = r.Type
+			}
+			row := []string{r.Type}
+			for _, f := range r.Fields {
+				row = append(row, f.Value)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if to == "json" {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("couldn't marshal json: %w", err)
+		}
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			return fmt.Errorf("couldn't write json: %w", err)
+		}
+	} else {
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(rows); err != nil {
+			return fmt.Errorf("couldn't write csv: %w", err)
+		}
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("couldn't close file %s: %w", output, err)
+		}
+	}
+	return nil
+}
+
+// DiffChange is the kind of change of a diff entry.
+type DiffChange string
+
+const (
+	DiffAdded   DiffChange = "added"
+	DiffRemoved DiffChange = "removed"
+	DiffChanged DiffChange = "changed"
+)
+
+// DiffEntry is a stock or sale detail that differs between two sinli files.
+// Prices are unit prices without VAT.
+type DiffEntry struct {
+	Change DiffChange `json:"change"`
+	// Sale number, or sale date for sales without tickets
+	Ticket      string       `json:"ticket,omitempty"`
+	ISBN        string       `json:"isbn"`
+	OldQuantity int          `json:"old_quantity"`
+	NewQuantity int          `json:"new_quantity"`
+	OldPrice    money.Amount `json:"old_price"`
+	NewPrice    money.Amount `json:"new_price"`
+}
+
+type diffKey struct {
+	ticket string
+	isbn   string
+}
+
+type diffValue struct {
+	quantity int
+	price    money.Amount
+}
+
+// Diff prints the stock or sale details added, removed or changed from the
+// sinli file a to the sinli file b.
+// Stock details are keyed by ISBN and sale details by ticket and ISBN.
+func Diff(ctx context.Context, a, b, format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid output format %s", format)
+	}
+	entries, err := diffSINLI(a, b)
+	if err != nil {
+		return err
+	}
+	return writeDiff(os.Stdout, entries, format)
+}
+
+// writeDiff writes the diff entries in text or json format.
+func writeDiff(out io.Writer, entries []DiffEntry, format string) error {
+	if format == "json" {
+		js, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("couldn't marshal json: %w", err)
+		}
+		fmt.Fprintln(out, string(js))
+		return nil
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "✅ no differences found")
+		return nil
+	}
+	counts := map[DiffChange]int{}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, e := range entries {
+		counts[e.Change]++
+		key := e.ISBN
+		if e.Ticket != "" {
+			key = fmt.Sprintf("%s %s", e.Ticket, e.ISBN)
+		}
+		switch e.Change {
+		case DiffAdded:
+			fmt.Fprintf(w, "+\t%s\tquantity %d\tprice %s\n", key, e.NewQuantity, e.NewPrice)
+		case DiffRemoved:
+			fmt.Fprintf(w, "-\t%s\tquantity %d\tprice %s\n", key, e.OldQuantity, e.OldPrice)
+		case DiffChanged:
+			quantity := strconv.Itoa(e.NewQuantity)
+			if e.OldQuantity != e.NewQuantity {
+				quantity = fmt.Sprintf("%d → %d", e.OldQuantity, e.NewQuantity)
+			}
+			price := e.NewPrice.String()
+			if e.OldPrice != e.NewPrice {
+				price = fmt.Sprintf("%s → %s", e.OldPrice, e.NewPrice)
+			}
+			fmt.Fprintf(w, "~\t%s\tquantity %s\tprice %s\n", key, quantity, price)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d added, %d removed, %d changed\n", counts[DiffAdded], counts[DiffRemoved], counts[DiffChanged])
+	return nil
+}
+
+func diffSINLI(a, b string) ([]DiffEntry, error) {
+	docA, err := readSINLI(a)
+	if err != nil {
+		return nil, err
+	}
+	docB, err := readSINLI(b)
+	if err != nil {
+		return nil, err
+	}
+	oldDetails, oldKind, err := diffDetails(docA)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't diff file %s: %w", a, err)
+	}
+	newDetails, newKind, err := diffDetails(docB)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't diff file %s: %w", b, err)
+	}
+	if oldKind != newKind {
+		return nil, fmt.Errorf("can't compare %s file %s with %s file %s", oldKind, a, newKind, b)
+	}
+
+	entries := []DiffEntry{}
+	for k, o := range oldDetails {
+		n, ok := newDetails[k]
+		switch {
+		case !ok:
+			entries = append(entries, DiffEntry{
+				Change:      DiffRemoved,
+				Ticket:      k.ticket,
+				ISBN:        k.isbn,
+				OldQuantity: o.quantity,
+				OldPrice:    o.price,
+			})
+		case o != n:
+			entries = append(entries, DiffEntry{
+				Change:      DiffChanged,
+				Ticket:      k.ticket,
+				ISBN:        k.isbn,
+				OldQuantity: o.quantity,
+				NewQuantity: n.quantity,
+				OldPrice:    o.price,
+				NewPrice:    n.price,
+			})
+		}
+	}
+	for k, n := range newDetails {
+		if _, ok := oldDetails[k]; ok {
+			continue
+		}
+		entries = append(entries, DiffEntry{
+			Change:      DiffAdded,
+			Ticket:      k.ticket,
+			ISBN:        k.isbn,
+			NewQuantity: n.quantity,
+			NewPrice:    n.price,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Ticket != entries[j].Ticket {
+			return entries[i].Ticket < entries[j].Ticket
+		}
+		return entries[i].ISBN < entries[j].ISBN
+	})
+	return entries, nil
+}
+
+// diffDetails returns the details of a stock or sale document by key, and
+// the kind of document.
+// Quantities of repeated keys are added up, keeping the last price.
+func diffDetails(doc interface{}) (map[diffKey]diffValue, string, error) {
+	details := map[diffKey]diffValue{}
+	add := func(k diffKey, quantity int, price money.Amount) {
+		v := details[k]
+		v.quantity += quantity
+		v.price = price
+		details[k] = v
+	}
+	switch d := doc.(type) {
+	case *sinli.Stock:
+		for _, item := range stockItems(d) {
+			add(diffKey{isbn: item.ISBN}, item.Quantity, item.PriceWithoutVAT)
+		}
+		return details, "stock", nil
+	case *sinli.Sale, *sinli.SaleV2:
+		for _, t := range saleTickets(d) {
+			ticket := t.SaleNumber
+			if ticket == "" {
+				ticket = t.SaleDate.Format("2006-01-02")
+			}
+			for _, item := range t.Items {
+				add(diffKey{ticket: ticket, isbn: item.ISBN}, item.Quantity, item.PriceWithoutVAT)
+			}
+		}
+		return details, "sale", nil
+	}
+	return nil, "", fmt.Errorf("unsupported document %T, only stock and sale files can be compared", doc)
+}
+
+// readSINLI reads a sinli file using the layout of its document.
+func readSINLI(file string) (interface{}, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open file %s: %w", file, err)
+	}
+	defer f.Close()
+	var doc interface{}
+	dec := sinli.NewDecoder(bufio.NewReader(f))
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal sinli file %s: %w", file, err)
+	}
+	// Records after the document aren't part of it
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected trailing records in %s", file)
+	}
+	return doc, nil
+}
+
+// SINLIStockItem is a stock item read from a sinli file, which doesn't carry
+// the name and the price with VAT of the book.
+type SINLIStockItem struct {
+	ISBN            string       `json:"isbn"`
+	Quantity        int          `json:"quantity"`
+	PriceWithoutVAT money.Amount `json:"price_without_vat"`
+}
+
+// stockItems converts the stock details to items.
+func stockItems(stock *sinli.Stock) []SINLIStockItem {
+	items := []SINLIStockItem{}
+	for _, d := range stock.Details {
+		items = append(items, SINLIStockItem{
+			ISBN:            d.ISBN,
+			Quantity:        d.Quantity,
+			PriceWithoutVAT: d.PriceWithoutVAT,
+		})
+	}
+	return items
+}
+
+// saleTickets converts the sale documents to tickets.
+// Version 2 documents have no tickets, so details are grouped by date.
+func saleTickets(doc interface{}) []SaleTicket {
+	tickets := []SaleTicket{}
+	switch sale := doc.(type) {
+	case *sinli.Sale:
+		for _, t := range sale.Tickets {
+			ticket := SaleTicket{
+				SaleDate:   t.SaleDate,
+				SaleNumber: t.SaleNumber,
+				NetAmount:  t.NetAmount,
+			}
+			for _, d := range t.Details {
+				ticket.Items = append(ticket.Items, SaleItem{
+					ISBN:            d.ISBN,
+					Quantity:        d.Quantity,
+					PriceWithoutVAT: d.PriceWithoutVAT,
+				})
+			}
+			tickets = append(tickets, ticket)
+		}
+	case *sinli.SaleV2:
+		for _, d := range sale.Details {
+			if len(tickets) == 0 || !tickets[len(tickets)-1].SaleDate.Equal(d.SaleDate) {
+				tickets = append(tickets, SaleTicket{SaleDate: d.SaleDate})
+			}
+			t := &tickets[len(tickets)-1]
+			t.Items = append(t.Items, SaleItem{
+				ISBN:            d.ISBN,
+				Quantity:        d.Quantity,
+				PriceWithoutVAT: d.PriceWithoutVAT,
+			})
+			t.NetAmount += d.PriceWithoutVAT.Mul(d.Quantity)
+		}
+	}
+	return tickets
+}
@@ -0,0 +1,297 @@
+package agorer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/money"
+	"github.com/igolaizola/agorer/pkg/sinli"
+)
+
+// writeTestSINLI marshals the sinli document to a file in the temp dir.
+func writeTestSINLI(t *testing.T, name string, v interface{}) string {
+	t.Helper()
+	b, err := sinli.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func testStock(t *testing.T, items []StockItem) *sinli.Stock {
+	t.Helper()
+	details, err := StockDetails(context.Background(), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sinli.Stock{
+		IdentificationHeader: sinli.IdentificationHeader{
+			Format:   sinli.FormatTypeNormalized,
+			Document: sinli.FileTypeStock,
+			Version:  sinli.FileVersionStock,
+		},
+		Identification: sinli.Identification{
+			FileType:    sinli.FileTypeStock,
+			FileVersion: sinli.FileVersionStock,
+		},
+		Header: sinli.StockHeader{
+			StockDate: time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC),
+			StockCoin: sinli.CoinEuro,
+		},
+		Details: details,
+	}
+}
+
+func TestConvertStock(t *testing.T) {
+	items := []StockItem{
+		{Name: "V for Vendetta", ISBN: "978-1-77951-119-5", Quantity: 2, PriceWithVAT: money.New(20.8), PriceWithoutVAT: money.New(20)},
+		{Name: "Binti", ISBN: "978-84-947958-8-6", Quantity: 1, PriceWithVAT: money.New(15.6), PriceWithoutVAT: money.New(15)},
+	}
+	file := writeTestSINLI(t, "stock.snl", testStock(t, items))
+	output := filepath.Join(t.TempDir(), "stock.json")
+	if err := Convert(context.Background(), file, "json", output); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// Converted items match the generated ones in the fields they carry
+	b, err = json.Marshal(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []map[string]any
+	if err := json.Unmarshal(b, &want); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range want {
+		delete(w, "name")
+		delete(w, "price_with_vat")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestReadSINLITrailing(t *testing.T) {
+	file := writeTestSINLI(t, "stock.snl", testStock(t, []StockItem{
+		{ISBN: "978-84-947958-8-6", Quantity: 1, PriceWithoutVAT: money.New(15)},
+	}))
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blank lines at the end are ignored
+	if err := os.WriteFile(file, append(b, "\r\n\r\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSINLI(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records after the document are rejected
+	if err := os.WriteFile(file, append(b, "junk\r\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = readSINLI(file)
+	if err == nil || !strings.Contains(err.Error(), "unexpected trailing records") {
+		t.Fatalf("want trailing records error, got %v", err)
+	}
+}
+
+func testSale(version sinli.FileVersion) sinli.IdentificationHeader {
+	return sinli.IdentificationHeader{
+		Format:   sinli.FormatTypeNormalized,
+		Document: sinli.FileTypeSale,
+		Version:  version,
+	}
+}
+
+func TestDiffSINLI(t *testing.T) {
+	day1 := time.Date(2023, 2, 27, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)
+	stock := func(details ...sinli.StockDetail) interface{} {
+		s := testStock(t, nil)
+		s.Details = details
+		return s
+	}
+	sale := func(tickets ...sinli.SaleTicket) interface{} {
+		return sinli.Sale{
+			IdentificationHeader: testSale(sinli.FileVersionSale),
+			Identification:       sinli.Identification{FileType: sinli.FileTypeSale, FileVersion: sinli.FileVersionSale},
+			Tickets:              tickets,
+		}
+	}
+	saleV2 := func(details ...sinli.SaleDetailV2) interface{} {
+		return sinli.SaleV2{
+			IdentificationHeader: testSale(sinli.FileVersionSaleV2),
+			Identification:       sinli.Identification{FileType: sinli.FileTypeSale, FileVersion: sinli.FileVersionSaleV2},
+			Details:              details,
+		}
+	}
+	const (
+		isbn1 = "9781779511195"
+		isbn2 = "9788494795886"
+		isbn3 = "9788418054525"
+	)
+
+	tests := []struct {
+		name    string
+		a, b    interface{}
+		want    []DiffEntry
+		wantErr bool
+	}{
+		{
+			name: "equal stock",
+			a:    stock(sinli.StockDetail{ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)}),
+			b:    stock(sinli.StockDetail{ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)}),
+			want: []DiffEntry{},
+		},
+		{
+			name: "stock added, removed and changed",
+			a: stock(
+				sinli.StockDetail{ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)},
+				sinli.StockDetail{ISBN: isbn2, Quantity: 2, PriceWithoutVAT: money.New(15)},
+			),
+			b: stock(
+				sinli.StockDetail{ISBN: isbn1, Quantity: 3, PriceWithoutVAT: money.New(21)},
+				sinli.StockDetail{ISBN: isbn3, Quantity: 1, PriceWithoutVAT: money.New(10)},
+			),
+			want: []DiffEntry{
+				{Change: DiffChanged, ISBN: isbn1, OldQuantity: 1, NewQuantity: 3, OldPrice: money.New(20), NewPrice: money.New(21)},
+				{Change: DiffAdded, ISBN: isbn3, NewQuantity: 1, NewPrice: money.New(10)},
+				{Change: DiffRemoved, ISBN: isbn2, OldQuantity: 2, OldPrice: money.New(15)},
+			},
+		},
+		{
+			name: "repeated stock details are added up",
+			a: stock(
+				sinli.StockDetail{ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)},
+				sinli.StockDetail{ISBN: isbn1, Quantity: 2, PriceWithoutVAT: money.New(20)},
+			),
+			b:    stock(sinli.StockDetail{ISBN: isbn1, Quantity: 3, PriceWithoutVAT: money.New(20)}),
+			want: []DiffEntry{},
+		},
+		{
+			name: "sales keyed by ticket and isbn",
+			a: sale(
+				sinli.SaleTicket{SaleDate: day2, SaleNumber: "12", Details: []sinli.SaleDetail{
+					{ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)},
+				}},
+			),
+			b: sale(
+				sinli.SaleTicket{SaleDate: day2, SaleNumber: "12", Details: []sinli.SaleDetail{
+					{ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)},
+				}},
+				sinli.SaleTicket{SaleDate: day2, SaleNumber: "13", Details: []sinli.SaleDetail{
+					{ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)},
+				}},
+			),
+			want: []DiffEntry{
+				{Change: DiffAdded, Ticket: "13", ISBN: isbn1, NewQuantity: 1, NewPrice: money.New(20)},
+			},
+		},
+		{
+			name: "sales v2 grouped by date",
+			a: saleV2(
+				sinli.SaleDetailV2{SaleDate: day1, ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)},
+				sinli.SaleDetailV2{SaleDate: day2, ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)},
+				sinli.SaleDetailV2{SaleDate: day2, ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)},
+			),
+			b: saleV2(
+				sinli.SaleDetailV2{SaleDate: day1, ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)},
+				sinli.SaleDetailV2{SaleDate: day2, ISBN: isbn1, Quantity: 1, PriceWithoutVAT: money.New(20)},
+			),
+			want: []DiffEntry{
+				{Change: DiffChanged, Ticket: "2023-02-28", ISBN: isbn1, OldQuantity: 2, NewQuantity: 1, OldPrice: money.New(20), NewPrice: money.New(20)},
+			},
+		},
+		{
+			name:    "stock and sale",
+			a:       stock(),
+			b:       sale(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := writeTestSINLI(t, "a.snl", tt.a)
+			b := writeTestSINLI(t, "b.snl", tt.b)
+			got, err := diffSINLI(a, b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %t, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			// Sort by change to compare regardless of the key order
+			sort.SliceStable(got, func(i, j int) bool { return got[i].Change < got[j].Change })
+			sort.SliceStable(tt.want, func(i, j int) bool { return tt.want[i].Change < tt.want[j].Change })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("want:\n%+v\ngot:\n%+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	entries := []DiffEntry{
+		{Change: DiffChanged, Ticket: "12", ISBN: "9781779511195", OldQuantity: 1, NewQuantity: 3, OldPrice: money.New(20), NewPrice: money.New(20)},
+		{Change: DiffAdded, Ticket: "13", ISBN: "9788494795886", NewQuantity: 1, NewPrice: money.New(15)},
+		{Change: DiffRemoved, ISBN: "9788418054525", OldQuantity: 2, OldPrice: money.New(10)},
+	}
+
+	var buf bytes.Buffer
+	if err := writeDiff(&buf, entries, "text"); err != nil {
+		t.Fatal(err)
+	}
+	want := "~  12 9781779511195  quantity 1 → 3  price 20.00\n" +
+		"+  13 9788494795886  quantity 1      price 15.00\n" +
+		"-  9788418054525     quantity 2      price 10.00\n" +
+		"1 added, 1 removed, 1 changed\n"
+	if buf.String() != want {
+		t.Fatalf("want:\n%s\ngot:\n%s", want, buf.String())
+	}
+
+	buf.Reset()
+	if err := writeDiff(&buf, nil, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "✅ no differences found\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+
+	buf.Reset()
+	if err := writeDiff(&buf, entries, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var got []DiffEntry
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Fatalf("want:\n%+v\ngot:\n%+v", entries, got)
+	}
+	if !strings.Contains(buf.String(), `"change": "removed"`) || strings.Contains(buf.String(), `"ticket": ""`) {
+		t.Fatalf("unexpected json %s", buf.String())
+	}
+}
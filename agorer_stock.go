@@ -15,36 +15,28 @@ import (
 	"github.com/igolaizola/agorer/pkg/agora"
 	"github.com/igolaizola/agorer/pkg/isbn"
 	"github.com/igolaizola/agorer/pkg/mail"
+	"github.com/igolaizola/agorer/pkg/money"
 	"github.com/igolaizola/agorer/pkg/sinli"
 )
 
 func Stock(ctx context.Context, c *Config) error {
 	// Validate config
-	if c.Input == "" {
+	if c.Input == "" && c.Agora == nil {
 		return errors.New("input must be provided")
 	}
 	if c.LogDir == "" {
 		return errors.New("log dir must be provided")
 	}
 	// Validate input type
-	var agoraHost string
-	switch c.InputType {
-	case "agora":
-		if c.AgoraToken == "" {
-			return errors.New("agora token must be provided")
-		}
-		agoraHost = c.Input
-	case "agora-json":
-		port, err := agora.MockServe(ctx, ":0", c.Input)
+	var client agora.API
+	if c.Agora != nil || c.InputType != "json" {
+		a, err := c.agoraAPI(ctx)
 		if err != nil {
-			return fmt.Errorf("couldn't mock serve agora: %w", err)
+			return err
 		}
-		agoraHost = fmt.Sprintf("http://localhost:%d", port)
-	case "json":
-	default:
-		return fmt.Errorf("invalid input type %s", c.InputType)
+		client = a
 	}
-	if agoraHost != "" {
+	if client != nil {
 		if c.ISBNDir == "" {
 			return errors.New("isbn dir must be provided")
 		}
@@ -52,19 +44,28 @@ func Stock(ctx context.Context, c *Config) error {
 
 	// Validate output type
 	output := c.Output
+	var format sinli.FormatType
 	switch c.OutputType {
 	case "json":
 		if output == "" {
 			output = filepath.Join(c.LogDir, fmt.Sprintf("stock_%s.json", time.Now().Format("20060102_150405")))
 		}
 	case "sinli":
+		f, err := c.sinliFormat()
+		if err != nil {
+			return err
+		}
+		format = f
+		if err := c.validateFallback(); err != nil {
+			return err
+		}
 		if output == "" {
-			output = filepath.Join(c.LogDir, fmt.Sprintf("sinli_N_%s_%s.snl", time.Now().Format("20060102_150405"), c.SINLISourceID))
+			output = filepath.Join(c.LogDir, fmt.Sprintf("sinli_%s_%s_%s.snl", format, time.Now().Format("20060102_150405"), c.SINLISourceID))
 		}
 		if c.SINLISourceEmail == "" {
 			return errors.New("sinli source email must be provided")
 		}
-		if c.SINLISourceID == "" {
+		if c.SINLISourceID == "" && c.StockWarehouseSources == "" {
 			return errors.New("sinli source id must be provided")
 		}
 		if c.SINLIDestinationEmail == "" {
@@ -76,6 +77,10 @@ func Stock(ctx context.Context, c *Config) error {
 		if c.SINLIClientName == "" {
 			return errors.New("sinli client name must be provided")
 		}
+		// Only the current version of the stock layout is supported
+		if _, err := c.sinliVersion(sinli.FileTypeStock, sinli.FileVersionStock); err != nil {
+			return err
+		}
 		if !c.Mail.Dry {
 			if c.Mail.Host == "" {
 				return errors.New("mail host must be provided")
@@ -101,10 +106,31 @@ func Stock(ctx context.Context, c *Config) error {
 		}
 	}
 
-	var stockItems []StockItem
-	if agoraHost != "" {
+	// Stock feeds to generate, one for each warehouse source or a single one
+	warehouses, err := c.stockWarehouses()
+	if err != nil {
+		return err
+	}
+	sources, err := c.stockWarehouseSources()
+	if err != nil {
+		return err
+	}
+	if len(sources) > 0 && client == nil {
+		return errors.New("stock warehouse sources require agora input")
+	}
+	feeds := []stockFeed{{sourceID: c.SINLISourceID, warehouses: warehouses, output: output}}
+	if len(sources) > 0 {
+		feeds = sources
+		for i := range feeds {
+			feeds[i].output = suffixOutput(output, feeds[i].sourceID)
+			if c.Output == "" && c.OutputType == "sinli" {
+				feeds[i].output = filepath.Join(c.LogDir, fmt.Sprintf("sinli_%s_%s_%s.snl", format, time.Now().Format("20060102_150405"), feeds[i].sourceID))
+			}
+		}
+	}
+
+	if client != nil {
 		// Export master data from Agora
-		client := agora.New(agoraHost, c.AgoraToken, c.LogDir)
 		master, err := client.ExportMaster(ctx)
 		if err != nil {
 			return fmt.Errorf("couldn't get master: %w", err)
@@ -118,12 +144,22 @@ func Stock(ctx context.Context, c *Config) error {
 
 		// Create store using master data and isbn client
 		s := NewStore(ctx, master, isbnClient)
-
 		var conflicts []Conflict
-		stockItems, conflicts, err = StockItems(ctx, s)
-		if err != nil {
-			return fmt.Errorf("couldn't generate stock: %w", err)
+		for i := range feeds {
+			for _, w := range feeds[i].warehouses {
+				if _, ok := s.Warehouses[w]; !ok {
+					log.Println("❌ warehouse not found", w)
+				}
+			}
+			items, cs, err := StockItems(ctx, s, feeds[i].warehouses...)
+			if err != nil {
+				return fmt.Errorf("couldn't generate stock: %w", err)
+			}
+			feeds[i].items = items
+			conflicts = append(conflicts, cs...)
 		}
+		// Books counted in several feeds are reported once
+		conflicts = uniqueConflicts(conflicts)
 
 		// Write conflicts to file
 		if len(conflicts) > 0 {
@@ -142,99 +178,203 @@ func Stock(ctx context.Context, c *Config) error {
 		if err != nil {
 			return fmt.Errorf("couldn't read file %s: %w", c.Input, err)
 		}
-		if err := json.Unmarshal(b, &stockItems); err != nil {
+		if err := json.Unmarshal(b, &feeds[0].items); err != nil {
 			return fmt.Errorf("couldn't unmarshal json: %w", err)
 		}
 	}
 
-	if c.OutputType == "json" {
-		// Write stock to json file
-		b, err := json.MarshalIndent(stockItems, "", "  ")
-		if err != nil {
-			return fmt.Errorf("couldn't marshal json: %w", err)
+	for _, feed := range feeds {
+		if c.OutputType == "json" {
+			// Write stock to json file
+			b, err := json.MarshalIndent(feed.items, "", "  ")
+			if err != nil {
+				return fmt.Errorf("couldn't marshal json: %w", err)
+			}
+			if err := os.WriteFile(feed.output, b, 0644); err != nil {
+				return fmt.Errorf("couldn't write file %s: %w", feed.output, err)
+			}
+			continue
 		}
-		if err := os.WriteFile(output, b, 0644); err != nil {
-			return fmt.Errorf("couldn't write file %s: %w", output, err)
+		if err := c.sendStock(ctx, feed, format); err != nil {
+			return err
 		}
-		return nil
 	}
+	return nil
+}
 
-	// Generate sinli stock
-	stockDetails, err := StockDetails(ctx, stockItems)
+// stockFeed is a stock file generated from the quantities of some
+// warehouses, all of them if empty.
+type stockFeed struct {
+	sourceID   string
+	warehouses []int
+	items      []StockItem
+	output     string
+}
+
+// sendStock writes the stock feed to a sinli file and sends it.
+func (c *Config) sendStock(ctx context.Context, feed stockFeed, format sinli.FormatType) error {
+	output := feed.output
+
+	// Obtain the transmission number of the destination.
+	// Feeds of other source IDs have their own numbers.
+	transmissionKey := c.SINLIDestinationID
+	if feed.sourceID != c.SINLISourceID {
+		transmissionKey = fmt.Sprintf("%s/%s", feed.sourceID, c.SINLIDestinationID)
+	}
+	transmissions, err := loadTransmissions(c.transmissionsFile())
 	if err != nil {
-		return fmt.Errorf("couldn't generate stock: %w", err)
+		return err
 	}
+	transmission := transmissions.next(transmissionKey)
 
-	// Create sinli stock
+	// Create sinli stock, details are streamed after the header records
 	stock := sinli.Stock{
 		IdentificationHeader: sinli.IdentificationHeader{
-			Format:        sinli.FormatTypeNormalized,
-			Document:      sinli.FileTypeStock,
-			Version:       sinli.FileVersionStock,
-			SourceID:      c.SINLISourceID,
-			DestinationID: c.SINLIDestinationID,
+			Format:             format,
+			Document:           sinli.FileTypeStock,
+			Version:            sinli.FileVersionStock,
+			SourceID:           feed.sourceID,
+			DestinationID:      c.SINLIDestinationID,
+			TransmissionNumber: transmission,
 		},
 		Identification: sinli.Identification{
-			SourceEmail:      c.SINLISourceEmail,
-			DestinationEmail: c.SINLIDestinationEmail,
-			FileType:         sinli.FileTypeStock,
-			FileVersion:      sinli.FileVersionStock,
+			SourceEmail:        c.SINLISourceEmail,
+			DestinationEmail:   c.SINLIDestinationEmail,
+			FileType:           sinli.FileTypeStock,
+			FileVersion:        sinli.FileVersionStock,
+			TransmissionNumber: transmission,
 		},
 		Header: sinli.StockHeader{
 			ClientName: c.SINLIClientName,
 			StockDate:  time.Now(),
 			StockCoin:  sinli.CoinEuro,
 		},
-		Details: stockDetails,
 	}
 
-	// Write sinli stock to output
-	b, err := sinli.Marshal(stock)
+	// Records are the header records plus a line for each detail
+	records, err := sinli.Records(stock)
 	if err != nil {
-		return fmt.Errorf("couldn't marshal sinli stock: %w", err)
+		return fmt.Errorf("couldn't count sinli records: %w", err)
 	}
-	if err := os.WriteFile(output, b, 0644); err != nil {
-		return fmt.Errorf("couldn't write file %s: %w", output, err)
+	stock.IdentificationHeader.Records = records + len(feed.items)
+
+	// Write sinli stock to output
+	if err := c.writeSINLI(output, func(enc *sinli.Encoder) error {
+		if err := enc.Encode(stock); err != nil {
+			return fmt.Errorf("couldn't marshal sinli stock: %w", err)
+		}
+		for _, item := range feed.items {
+			if err := enc.Encode(stockDetail(item)); err != nil {
+				return fmt.Errorf("couldn't marshal sinli stock detail %s: %w", item.ISBN, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
 
 	// Marshal subject
 	sinliSubject := sinli.Subject{
-		SourceID:      c.SINLISourceID,
+		SourceID:      feed.sourceID,
 		DestinationID: c.SINLIDestinationID,
 		FileType:      sinli.FileTypeStock,
 		FileVersion:   sinli.FileVersionStock,
 	}
-	b, err = sinli.Marshal(sinliSubject)
+	b, err := sinli.Marshal(sinliSubject)
 	if err != nil {
 		return fmt.Errorf("couldn't marshal sinli subject: %w", err)
 	}
 	subject := strings.TrimSpace(string(b))
 
+	// Validate the file before sending it
+	if err := checkSINLI(output); err != nil {
+		return err
+	}
+
 	// Send email
 	if err := mail.Send(ctx, &c.Mail, c.SINLISourceEmail, c.SINLIDestinationEmail, subject, "", output); err != nil {
 		return fmt.Errorf("couldn't send email: %w", err)
 	}
+
+	// Save the transmission number once the file has been sent
+	if !c.Mail.Dry {
+		if err := transmissions.save(transmissionKey, transmission); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// location returns the storage locations of the product in the warehouses,
+// or all of them if none is given.
+func location(p agora.Product, warehouses []int) string {
+	var locations []string
+	seen := map[string]struct{}{}
+	for _, st := range p.StorageOptions {
+		if len(warehouses) > 0 && !containsInt(warehouses, st.WarehouseID) {
+			continue
+		}
+		loc := strings.TrimSpace(st.Location)
+		if loc == "" {
+			continue
+		}
+		if _, ok := seen[loc]; ok {
+			continue
+		}
+		seen[loc] = struct{}{}
+		locations = append(locations, loc)
+	}
+	return strings.Join(locations, ", ")
+}
+
+func containsString(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// suffixOutput adds a suffix to the name of the output file.
+func suffixOutput(output string, suffix string) string {
+	ext := filepath.Ext(output)
+	return fmt.Sprintf("%s_%s%s", strings.TrimSuffix(output, ext), suffix, ext)
+}
+
 func StockDetails(ctx context.Context, items []StockItem) ([]sinli.StockDetail, error) {
 	var details []sinli.StockDetail
 	for _, item := range items {
-		details = append(details, sinli.StockDetail{
-			ISBN:            item.ISBN,
-			Quantity:        item.Quantity,
-			PriceWithoutVAT: item.PriceWithoutVAT,
-		})
+		details = append(details, stockDetail(item))
 	}
 	return details, nil
 }
 
+func stockDetail(item StockItem) sinli.StockDetail {
+	return sinli.StockDetail{
+		ISBN:            item.ISBN,
+		Quantity:        item.Quantity,
+		PriceWithoutVAT: item.PriceWithoutVAT,
+	}
+}
+
 type StockItem struct {
-	Name            string  `json:"name"`
-	ISBN            string  `json:"isbn"`
-	Quantity        int     `json:"quantity"`
-	PriceWithVAT    float32 `json:"price_with_vat"`
-	PriceWithoutVAT float32 `json:"price_without_vat"`
+	Name            string       `json:"name"`
+	ISBN            string       `json:"isbn"`
+	Quantity        int          `json:"quantity"`
+	PriceWithVAT    money.Amount `json:"price_with_vat"`
+	PriceWithoutVAT money.Amount `json:"price_without_vat"`
+	// Storage location in the warehouses counted
+	Location string `json:"location,omitempty"`
 }
 
 type Conflict struct {
@@ -242,9 +382,38 @@ type Conflict struct {
 	Names []string
 }
 
-func StockItems(ctx context.Context, s *Store) ([]StockItem, []Conflict, error) {
+// uniqueConflicts merges the conflicts of the same isbn, found in several
+// stock feeds, so each one is reported once.
+func uniqueConflicts(conflicts []Conflict) []Conflict {
+	var unique []Conflict
+	index := map[string]int{}
+	for _, c := range conflicts {
+		i, ok := index[c.ISBN]
+		if !ok {
+			i = len(unique)
+			index[c.ISBN] = i
+			unique = append(unique, Conflict{ISBN: c.ISBN})
+		}
+		for _, name := range c.Names {
+			if !containsString(unique[i].Names, name) {
+				unique[i].Names = append(unique[i].Names, name)
+			}
+		}
+	}
+	for _, c := range unique {
+		sort.Strings(c.Names)
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		return unique[i].ISBN < unique[j].ISBN
+	})
+	return unique
+}
+
+// StockItems returns the stock of the books in the given warehouses, or all
+// of them if none is given.
+func StockItems(ctx context.Context, s *Store, warehouses ...int) ([]StockItem, []Conflict, error) {
 	var items []StockItem
-	for id, qty := range s.Quantity {
+	for id, qty := range s.QuantityIn(warehouses...) {
 		select {
 		case <-ctx.Done():
 			return nil, nil, ctx.Err()
@@ -286,11 +455,11 @@ func StockItems(ctx context.Context, s *Store) ([]StockItem, []Conflict, error)
 		if priceList.VatIncluded {
 			rate := vat.VatRate
 			// Remove VAT from price
-			priceWithoutVAT = priceData.Price / (1 + rate)
+			priceWithoutVAT = priceData.Price.WithoutVAT(float64(rate))
 		} else {
 			rate := vat.VatRate
 			// Add VAT to price
-			priceWithVAT = priceData.Price * (1 + rate)
+			priceWithVAT = priceData.Price.WithVAT(float64(rate))
 		}
 
 		items = append(items, StockItem{
@@ -299,6 +468,7 @@ func StockItems(ctx context.Context, s *Store) ([]StockItem, []Conflict, error)
 			Quantity:        qty,
 			PriceWithoutVAT: priceWithoutVAT,
 			PriceWithVAT:    priceWithVAT,
+			Location:        location(p, warehouses),
 		})
 	}
 
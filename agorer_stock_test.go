@@ -0,0 +1,183 @@
+package agorer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/igolaizola/agorer/pkg/agora"
+	"github.com/igolaizola/agorer/pkg/money"
+)
+
+func TestQuantityIn(t *testing.T) {
+	s := &Store{
+		Quantity: map[int]int{1: 5, 2: 1},
+		WarehouseQuantity: map[int]map[int]int{
+			1: {1: 2, 2: 3},
+			2: {2: 1},
+		},
+	}
+	tests := []struct {
+		name       string
+		warehouses []int
+		want       map[int]int
+	}{
+		{"all", nil, map[int]int{1: 5, 2: 1}},
+		{"one", []int{1}, map[int]int{1: 2}},
+		{"several", []int{1, 2}, map[int]int{1: 5, 2: 1}},
+		{"unknown", []int{3}, map[int]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.QuantityIn(tt.warehouses...); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStockWarehouseSources(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []stockFeed
+		wantErr bool
+	}{
+		{value: ""},
+		{
+			value: "1:L0000001",
+			want:  []stockFeed{{sourceID: "L0000001", warehouses: []int{1}}},
+		},
+		{
+			value: " 1 : L0000001, 2:L0000002,3:L0000001 ",
+			want: []stockFeed{
+				{sourceID: "L0000001", warehouses: []int{1, 3}},
+				{sourceID: "L0000002", warehouses: []int{2}},
+			},
+		},
+		{value: "1", wantErr: true},
+		{value: "a:L0000001", wantErr: true},
+		{value: "1:", wantErr: true},
+	}
+	for _, tt := range tests {
+		c := &Config{StockWarehouseSources: tt.value}
+		got, err := c.stockWarehouseSources()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: want error %t, got %v", tt.value, tt.wantErr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: want %+v, got %+v", tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	p := agora.Product{
+		StorageOptions: []agora.ProductStorage{
+			{WarehouseID: 1, Location: "A1"},
+			{WarehouseID: 2, Location: " B2 "},
+			{WarehouseID: 3, Location: "A1"},
+			{WarehouseID: 4},
+		},
+	}
+	tests := []struct {
+		warehouses []int
+		want       string
+	}{
+		{nil, "A1, B2"},
+		{[]int{2}, "B2"},
+		{[]int{3, 1}, "A1"},
+		{[]int{4}, ""},
+		{[]int{5}, ""},
+	}
+	for _, tt := range tests {
+		if got := location(p, tt.warehouses); got != tt.want {
+			t.Errorf("%v: want %q, got %q", tt.warehouses, tt.want, got)
+		}
+	}
+}
+
+func TestUniqueConflicts(t *testing.T) {
+	got := uniqueConflicts([]Conflict{
+		{ISBN: "978-84-947958-8-6", Names: []string{"B", "C"}},
+		{ISBN: "978-1-77951-119-5", Names: []string{"X", "Y"}},
+		{ISBN: "978-84-947958-8-6", Names: []string{"A", "B"}},
+	})
+	want := []Conflict{
+		{ISBN: "978-1-77951-119-5", Names: []string{"X", "Y"}},
+		{ISBN: "978-84-947958-8-6", Names: []string{"A", "B", "C"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestStockWarehouseConflicts(t *testing.T) {
+	book := func(id int, name string) agora.Product {
+		return agora.Product{
+			ID:       id,
+			Name:     name,
+			VatID:    1,
+			Barcodes: []agora.ProductBarcode{{Value: "9788494795886"}},
+			Prices:   []agora.ProductPrice{{PriceListID: 1, Price: money.New(20.8)}},
+		}
+	}
+	fake := &fakeAgora{
+		master: &agora.Master{
+			Vats:       []agora.Vat{{ID: 1, VatRate: 0.04, Enabled: true}},
+			PriceLists: []agora.PriceList{{ID: 1, VatIncluded: true}},
+			Warehouses: []agora.Warehouse{{ID: 1}, {ID: 2}},
+			Products:   []agora.Product{book(1, "Book"), book(2, "Book copy")},
+			Stocks: []agora.Stock{
+				{WarehouseID: 1, ProductID: 1, Quantity: 1},
+				{WarehouseID: 1, ProductID: 2, Quantity: 1},
+				{WarehouseID: 2, ProductID: 1, Quantity: 2},
+				{WarehouseID: 2, ProductID: 2, Quantity: 2},
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	c := &Config{
+		Agora:                 fake,
+		ISBNDir:               testISBNDir(t, map[string]string{"9788494795886": "978-84-947958-8-6"}),
+		LogDir:                dir,
+		OutputType:            "json",
+		Output:                filepath.Join(dir, "stock.json"),
+		StockWarehouseSources: "1:L0000001,2:L0000002",
+	}
+	if err := Stock(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file is written for each source
+	for _, source := range []string{"L0000001", "L0000002"} {
+		if _, err := os.Stat(filepath.Join(dir, "stock_"+source+".json")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The conflict is reported once, although it's found in both feeds
+	files, err := filepath.Glob(filepath.Join(dir, "conflicts_*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("want 1 conflicts file, got %d", len(files))
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Conflict
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []Conflict{{ISBN: "978-84-947958-8-6", Names: []string{"Book", "Book copy"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,155 @@
+package agorer
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/igolaizola/agorer/pkg/agora"
+	"github.com/igolaizola/agorer/pkg/isbn"
+)
+
+func TestNewStore(t *testing.T) {
+	dir := testISBNDir(t, map[string]string{"9788494795886": "978-84-947958-8-6"})
+	isbnClient, err := isbn.New(filepath.Join(dir, "isbn.json"), filepath.Join(dir, "isbn_err.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := &agora.Master{
+		Vats: []agora.Vat{
+			{ID: 1, VatRate: 0.04, Enabled: true},
+			{ID: 2, VatRate: 0.21, Enabled: true},
+		},
+		Products: []agora.Product{
+			{ID: 1, Name: "Book", VatID: 1, Barcodes: []agora.ProductBarcode{{Value: "978-84-947958-8-6"}}},
+			{ID: 2, Name: "Mug", VatID: 2},
+			{ID: 3, Name: "Old mug", VatID: 2, DeletionDate: "2022-01-01T00:00:00"},
+		},
+	}
+	s := NewStore(context.Background(), master, isbnClient)
+
+	// All the products not deleted are kept, but only books are indexed
+	for _, id := range []int{1, 2} {
+		if _, ok := s.Products[id]; !ok {
+			t.Fatalf("want product %d, got %v", id, s.Products)
+		}
+	}
+	if len(s.Products) != 2 {
+		t.Fatalf("want 2 products, got %d", len(s.Products))
+	}
+	if len(s.Books) != 1 {
+		t.Fatalf("want 1 book, got %d", len(s.Books))
+	}
+	p, ok := s.Book("978-84-947958-8-6")
+	if !ok || p.ID != 1 {
+		t.Fatalf("want book 1, got %v %t", p, ok)
+	}
+}
+
+func TestFamilyPath(t *testing.T) {
+	id := func(i int) *int { return &i }
+	tests := []struct {
+		name     string
+		families []agora.Family
+		want     []string
+	}{
+		{
+			name: "no family",
+		},
+		{
+			name:     "root family",
+			families: []agora.Family{{ID: 1, Name: "Books"}},
+			want:     []string{"Books"},
+		},
+		{
+			name: "nested families",
+			families: []agora.Family{
+				{ID: 1, Name: "Comics", ParentFamilyID: id(2)},
+				{ID: 2, Name: "Books", ParentFamilyID: id(3)},
+				{ID: 3, Name: "Shop"},
+			},
+			want: []string{"Shop", "Books", "Comics"},
+		},
+		{
+			name: "missing parent",
+			families: []agora.Family{
+				{ID: 1, Name: "Comics", ParentFamilyID: id(2)},
+			},
+			want: []string{"Comics"},
+		},
+		{
+			name: "loop",
+			families: []agora.Family{
+				{ID: 1, Name: "Comics", ParentFamilyID: id(2)},
+				{ID: 2, Name: "Books", ParentFamilyID: id(1)},
+			},
+			want: []string{"Books", "Comics"},
+		},
+		{
+			name: "own parent",
+			families: []agora.Family{
+				{ID: 1, Name: "Comics", ParentFamilyID: id(1)},
+			},
+			want: []string{"Comics"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Store{Families: map[int]agora.Family{}}
+			for _, f := range tt.families {
+				s.Families[f.ID] = f
+			}
+			got := s.FamilyPath(agora.Product{FamilyID: 1})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNormalizeCIF(t *testing.T) {
+	tests := []struct {
+		cif  string
+		want string
+	}{
+		{"B12345678", "B12345678"},
+		{"b12345678", "B12345678"},
+		{"B-12.345.678", "B12345678"},
+		{" B 12345678 ", "B12345678"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeCIF(tt.cif); got != tt.want {
+			t.Errorf("%q: want %q, got %q", tt.cif, tt.want, got)
+		}
+	}
+}
+
+func TestSupplier(t *testing.T) {
+	master := &agora.Master{
+		Suppliers: []agora.Supplier{
+			{ID: 1, FiscalName: "Old", Cif: "B12345678", DeletionDate: "2022-01-01T00:00:00"},
+			{ID: 2, FiscalName: "New", Cif: "b-12345678"},
+			{ID: 3, FiscalName: "Gone", Cif: "A87654321", DeletionDate: "2022-01-01T00:00:00"},
+			{ID: 4, FiscalName: "No CIF"},
+		},
+	}
+	s := NewStore(context.Background(), master, nil)
+
+	tests := []struct {
+		cif  string
+		want int
+	}{
+		{"B12345678", 2},
+		{"b 12.345.678", 2},
+		{"A87654321", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		sp, ok := s.Supplier(tt.cif)
+		if ok != (tt.want != 0) || sp.ID != tt.want {
+			t.Errorf("%q: want supplier %d, got %d %t", tt.cif, tt.want, sp.ID, ok)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package agorer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// transmissions stores the last transmission number sent to each sinli
+// destination, so they can detect missing or duplicated transmissions.
+type transmissions struct {
+	file string
+	last map[string]int
+}
+
+func loadTransmissions(file string) (*transmissions, error) {
+	last := map[string]int{}
+	b, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("couldn't read file %s: %w", file, err)
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &last); err != nil {
+			return nil, fmt.Errorf("couldn't parse file %s: %w", file, err)
+		}
+	}
+	return &transmissions{
+		file: file,
+		last: last,
+	}, nil
+}
+
+// next returns the transmission number for the next file sent to the
+// destination.
+func (t *transmissions) next(destination string) int {
+	return t.last[destination] + 1
+}
+
+// save stores the transmission number once the file has been sent.
+func (t *transmissions) save(destination string, number int) error {
+	t.last[destination] = number
+	b, err := json.MarshalIndent(t.last, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal transmissions: %w", err)
+	}
+	if err := os.WriteFile(t.file, b, 0644); err != nil {
+		return fmt.Errorf("couldn't write file %s: %w", t.file, err)
+	}
+	return nil
+}
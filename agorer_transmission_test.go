@@ -0,0 +1,90 @@
+package agorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/mail"
+	"github.com/igolaizola/agorer/pkg/sinli"
+)
+
+func TestTransmissions(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "transmissions.json")
+
+	// A missing file starts all destinations from 1
+	ts, err := loadTransmissions(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ts.next("LIB00022"); n != 1 {
+		t.Fatalf("want 1, got %d", n)
+	}
+	if err := ts.save("LIB00022", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.save("L0000002/LIB00022", 7); err != nil {
+		t.Fatal(err)
+	}
+
+	// Numbers are kept per destination
+	ts, err = loadTransmissions(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ts.next("LIB00022"); n != 2 {
+		t.Fatalf("want 2, got %d", n)
+	}
+	if n := ts.next("L0000002/LIB00022"); n != 8 {
+		t.Fatalf("want 8, got %d", n)
+	}
+	if n := ts.next("LIB00099"); n != 1 {
+		t.Fatalf("want 1, got %d", n)
+	}
+
+	// Invalid files aren't overwritten
+	if err := os.WriteFile(file, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTransmissions(file); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestTransmissionsDry(t *testing.T) {
+	dir := t.TempDir()
+	c := &Config{
+		LogDir:                dir,
+		SINLISourceEmail:      "me@shop.com",
+		SINLISourceID:         "L0000001",
+		SINLIDestinationEmail: "sinli@cegal.es",
+		SINLIDestinationID:    "LIB00022",
+		SINLIClientName:       "AWESOME BOOK STORE",
+		Mail:                  mail.Config{Dry: true},
+	}
+	day := time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)
+
+	// Dry runs don't consume transmission numbers
+	for i := 0; i < 2; i++ {
+		output := filepath.Join(dir, "sale.snl")
+		if err := c.sendSales(context.Background(), nil, day, sinli.FormatTypeNormalized, sinli.FileVersionSale, output); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sale sinli.Sale
+		if err := sinli.Unmarshal(b, &sale); err != nil {
+			t.Fatal(err)
+		}
+		if n := sale.IdentificationHeader.TransmissionNumber; n != 1 {
+			t.Fatalf("want transmission 1, got %d", n)
+		}
+	}
+	if _, err := os.Stat(c.transmissionsFile()); !os.IsNotExist(err) {
+		t.Fatalf("want no transmissions file, got %v", err)
+	}
+}
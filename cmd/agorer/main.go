@@ -5,11 +5,13 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime/debug"
 	"strings"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/igolaizola/agorer"
 	"github.com/igolaizola/agorer/pkg/agora"
@@ -49,7 +51,12 @@ func newCommand() *ffcli.Command {
 			newVersionCommand(),
 			newStockCommand(),
 			newSalesCommand(),
+			newReceiveCommand(),
+			newInvoiceCommand(),
+			newCatalogCommand(),
+			newSinliCommand(),
 			newMockServeCommand(),
+			newAnonymizeCommand(),
 			newExampleCommand(),
 			newMailCommand(),
 		},
@@ -99,6 +106,9 @@ func newStockCommand() *ffcli.Command {
 
 	// Agora parameters
 	fs.StringVar(&cfg.AgoraToken, "agora-token", "", "agora token")
+	fs.IntVar(&cfg.AgoraRetries, "agora-retries", 3, "retries of transient agora failures")
+	fs.DurationVar(&cfg.AgoraRetryWait, "agora-retry-wait", 2*time.Second, "wait before the first agora retry, doubled on each retry")
+	fs.StringVar(&cfg.Timezone, "timezone", "Europe/Madrid", "time zone of the store, local if empty")
 	// ISBN parameters
 	fs.StringVar(&cfg.ISBNDir, "isbn-dir", "data", "isbn directory")
 
@@ -115,6 +125,16 @@ func newStockCommand() *ffcli.Command {
 	fs.StringVar(&cfg.SINLIDestinationEmail, "sinli-destination-email", "", "sinli destination email")
 	fs.StringVar(&cfg.SINLIDestinationID, "sinli-destination-id", "", "sinli destination id")
 	fs.StringVar(&cfg.SINLIClientName, "sinli-client-name", "", "sinli client name")
+	fs.IntVar(&cfg.SINLIVersion, "sinli-version", 0, "sinli document version (default latest)")
+	fs.StringVar(&cfg.SINLIFormat, "sinli-format", "N", "sinli format (N normalized, L free)")
+	fs.BoolVar(&cfg.SINLIStrict, "sinli-strict", false, "fail if a sinli value exceeds its field length or is a negative number")
+	fs.BoolVar(&cfg.SINLITruncate, "sinli-truncate", false, "truncate sinli texts that exceed their field length")
+	fs.StringVar(&cfg.SINLIFallback, "sinli-fallback", "", "fallback for characters that can't be encoded (transliterate, replace), fails if empty")
+	fs.StringVar(&cfg.SINLITransmissionsFile, "sinli-transmissions-file", "", "file to store sinli transmission numbers (default log-dir/transmissions.json)")
+
+	// Stock parameters
+	fs.StringVar(&cfg.StockWarehouses, "stock-warehouses", "", "comma separated warehouse ids counted in the stock (default all)")
+	fs.StringVar(&cfg.StockWarehouseSources, "stock-warehouse-sources", "", "comma separated warehouse-id:sinli-source-id pairs to send a stock file for each source id (optional)")
 
 	return &ffcli.Command{
 		Name:       cmd,
@@ -137,19 +157,25 @@ func newSalesCommand() *ffcli.Command {
 	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
 	_ = fs.String("config", "", "config file (optional)")
 
-	var day string
-	fs.StringVar(&day, "day", time.Now().UTC().Format("2006-01-02"), "day to process")
+	var day, from, to string
+	fs.StringVar(&day, "day", "", "day to process (default current business day)")
+	fs.StringVar(&from, "from", "", "first day of the range to process (default day)")
+	fs.StringVar(&to, "to", "", "last day of the range to process (default day)")
 
 	var cfg agorer.Config
 	fs.BoolVar(&cfg.Debug, "debug", false, "debug mode")
 	fs.StringVar(&cfg.LogDir, "log-dir", "logs", "output directory")
-	fs.StringVar(&cfg.Input, "input", "", "input file or URL")
+	fs.StringVar(&cfg.Input, "input", "", "input file, directory or URL")
 	fs.StringVar(&cfg.InputType, "input-type", "", "input type (json, agora, agora-json)")
-	fs.StringVar(&cfg.Output, "output", "", "output file")
+	fs.StringVar(&cfg.Output, "output", "", "output file or directory")
 	fs.StringVar(&cfg.OutputType, "output-type", "", "output type (json, sinli)")
 
 	// Agora parameters
 	fs.StringVar(&cfg.AgoraToken, "agora-token", "", "agora token")
+	fs.IntVar(&cfg.AgoraRetries, "agora-retries", 3, "retries of transient agora failures")
+	fs.DurationVar(&cfg.AgoraRetryWait, "agora-retry-wait", 2*time.Second, "wait before the first agora retry, doubled on each retry")
+	fs.StringVar(&cfg.Timezone, "timezone", "Europe/Madrid", "time zone of the store, local if empty")
+	fs.IntVar(&cfg.AgoraWorkers, "agora-workers", 4, "days exported concurrently from agora")
 	// ISBN parameters
 	fs.StringVar(&cfg.ISBNDir, "isbn-dir", "data", "isbn directory")
 
@@ -166,6 +192,13 @@ func newSalesCommand() *ffcli.Command {
 	fs.StringVar(&cfg.SINLIDestinationEmail, "sinli-destination-email", "", "sinli destination email")
 	fs.StringVar(&cfg.SINLIDestinationID, "sinli-destination-id", "", "sinli destination id")
 	fs.StringVar(&cfg.SINLIClientName, "sinli-client-name", "", "sinli client name")
+	fs.IntVar(&cfg.SINLIVersion, "sinli-version", 0, "sinli document version (default latest)")
+	fs.StringVar(&cfg.SINLIFormat, "sinli-format", "N", "sinli format (N normalized, L free)")
+	fs.BoolVar(&cfg.SINLIStrict, "sinli-strict", false, "fail if a sinli value exceeds its field length or is a negative number")
+	fs.BoolVar(&cfg.SINLITruncate, "sinli-truncate", false, "truncate sinli texts that exceed their field length")
+	fs.StringVar(&cfg.SINLIFallback, "sinli-fallback", "", "fallback for characters that can't be encoded (transliterate, replace), fails if empty")
+	fs.StringVar(&cfg.SINLITransmissionsFile, "sinli-transmissions-file", "", "file to store sinli transmission numbers (default log-dir/transmissions.json)")
+	fs.BoolVar(&cfg.SINLIDaily, "sinli-daily", false, "send a sinli file for each day of the range")
 
 	return &ffcli.Command{
 		Name:       cmd,
@@ -178,11 +211,251 @@ func newSalesCommand() *ffcli.Command {
 		ShortHelp: fmt.Sprintf("%s agorer command", cmd),
 		FlagSet:   fs,
 		Exec: func(ctx context.Context, args []string) error {
-			d, err := time.Parse("2006-01-02", day)
+			if day == "" {
+				loc, err := agora.LoadLocation(cfg.Timezone)
+				if err != nil {
+					return err
+				}
+				day = agora.BusinessDay(time.Now(), loc).Format("2006-01-02")
+			}
+			if from == "" {
+				from = day
+			}
+			if to == "" {
+				to = day
+			}
+			f, err := time.Parse("2006-01-02", from)
+			if err != nil {
+				return fmt.Errorf("couldn't parse from: %w", err)
+			}
+			t, err := time.Parse("2006-01-02", to)
 			if err != nil {
-				return fmt.Errorf("couldn't parse day: %w", err)
+				return fmt.Errorf("couldn't parse to: %w", err)
+			}
+			return agorer.SalesRange(ctx, &cfg, f, t)
+		},
+	}
+}
+
+func newReceiveCommand() *ffcli.Command {
+	cmd := "receive"
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	_ = fs.String("config", "", "config file (optional)")
+
+	var cfg agorer.Config
+	fs.BoolVar(&cfg.Debug, "debug", false, "debug mode")
+	fs.StringVar(&cfg.LogDir, "log-dir", "logs", "output directory")
+	fs.StringVar(&cfg.Input, "input", "", "input file or URL")
+	fs.StringVar(&cfg.InputType, "input-type", "", "input type (agora, agora-json)")
+	fs.StringVar(&cfg.Output, "output", "", "output file")
+
+	// Agora parameters
+	fs.StringVar(&cfg.AgoraToken, "agora-token", "", "agora token")
+	fs.IntVar(&cfg.AgoraRetries, "agora-retries", 3, "retries of transient agora failures")
+	fs.DurationVar(&cfg.AgoraRetryWait, "agora-retry-wait", 2*time.Second, "wait before the first agora retry, doubled on each retry")
+	fs.StringVar(&cfg.Timezone, "timezone", "Europe/Madrid", "time zone of the store, local if empty")
+	// ISBN parameters
+	fs.StringVar(&cfg.ISBNDir, "isbn-dir", "data", "isbn directory")
+
+	return &ffcli.Command{
+		Name:       cmd,
+		ShortUsage: fmt.Sprintf("agorer %s [flags] <envio file>", cmd),
+		Options: []ff.Option{
+			ff.WithConfigFileFlag("config"),
+			ff.WithConfigFileParser(ff.PlainParser),
+			ff.WithEnvVarPrefix("AGORER"),
+			// Config files may be shared with the stock and sales commands
+			ff.WithIgnoreUndefined(true),
+		},
+		ShortHelp: fmt.Sprintf("%s agorer command", cmd),
+		FlagSet:   fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return agorer.Receive(ctx, &cfg, args[0])
+		},
+	}
+}
+
+func newInvoiceCommand() *ffcli.Command {
+	cmd := "invoice"
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	_ = fs.String("config", "", "config file (optional)")
+
+	var cfg agorer.Config
+	fs.BoolVar(&cfg.Debug, "debug", false, "debug mode")
+	fs.StringVar(&cfg.LogDir, "log-dir", "logs", "output directory")
+	fs.StringVar(&cfg.Input, "input", "", "input file or URL")
+	fs.StringVar(&cfg.InputType, "input-type", "", "input type (agora, agora-json)")
+	fs.StringVar(&cfg.Output, "output", "", "output file")
+	fs.StringVar(&cfg.OutputType, "output-type", "json", "output type (json, csv)")
+
+	// Agora parameters
+	fs.StringVar(&cfg.AgoraToken, "agora-token", "", "agora token")
+	fs.IntVar(&cfg.AgoraRetries, "agora-retries", 3, "retries of transient agora failures")
+	fs.DurationVar(&cfg.AgoraRetryWait, "agora-retry-wait", 2*time.Second, "wait before the first agora retry, doubled on each retry")
+	fs.StringVar(&cfg.Timezone, "timezone", "Europe/Madrid", "time zone of the store, local if empty")
+	// ISBN parameters
+	fs.StringVar(&cfg.ISBNDir, "isbn-dir", "data", "isbn directory")
+
+	return &ffcli.Command{
+		Name:       cmd,
+		ShortUsage: fmt.Sprintf("agorer %s [flags] <factul file>", cmd),
+		Options: []ff.Option{
+			ff.WithConfigFileFlag("config"),
+			ff.WithConfigFileParser(ff.PlainParser),
+			ff.WithEnvVarPrefix("AGORER"),
+			// Config files may be shared with the stock and sales commands
+			ff.WithIgnoreUndefined(true),
+		},
+		ShortHelp: fmt.Sprintf("%s agorer command", cmd),
+		FlagSet:   fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return agorer.Invoice(ctx, &cfg, args[0])
+		},
+	}
+}
+
+func newCatalogCommand() *ffcli.Command {
+	cmd := "catalog"
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	_ = fs.String("config", "", "config file (optional)")
+
+	var cfg agorer.Config
+	fs.BoolVar(&cfg.Debug, "debug", false, "debug mode")
+	fs.StringVar(&cfg.LogDir, "log-dir", "logs", "output directory")
+	fs.StringVar(&cfg.Input, "input", "", "input file or URL")
+	fs.StringVar(&cfg.InputType, "input-type", "", "input type (agora, agora-json)")
+	fs.StringVar(&cfg.Output, "output", "", "output file")
+	fs.IntVar(&cfg.CatalogPriceList, "catalog-price-list", 0, "price list id of the catalog prices (default first one not deleted)")
+
+	// Agora parameters
+	fs.StringVar(&cfg.AgoraToken, "agora-token", "", "agora token")
+	fs.IntVar(&cfg.AgoraRetries, "agora-retries", 3, "retries of transient agora failures")
+	fs.DurationVar(&cfg.AgoraRetryWait, "agora-retry-wait", 2*time.Second, "wait before the first agora retry, doubled on each retry")
+	fs.StringVar(&cfg.Timezone, "timezone", "Europe/Madrid", "time zone of the store, local if empty")
+
+	return &ffcli.Command{
+		Name:       cmd,
+		ShortUsage: fmt.Sprintf("agorer %s [flags] <libros file>", cmd),
+		Options: []ff.Option{
+			ff.WithConfigFileFlag("config"),
+			ff.WithConfigFileParser(ff.PlainParser),
+			ff.WithEnvVarPrefix("AGORER"),
+			// Config files may be shared with the stock and sales commands
+			ff.WithIgnoreUndefined(true),
+		},
+		ShortHelp: fmt.Sprintf("%s agorer command", cmd),
+		FlagSet:   fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
 			}
-			return agorer.Sales(ctx, &cfg, d)
+			return agorer.Catalog(ctx, &cfg, args[0])
+		},
+	}
+}
+
+func newSinliCommand() *ffcli.Command {
+	cmd := "sinli"
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+
+	return &ffcli.Command{
+		Name:       cmd,
+		ShortUsage: fmt.Sprintf("agorer %s <subcommand>", cmd),
+		ShortHelp:  fmt.Sprintf("%s agorer command", cmd),
+		FlagSet:    fs,
+		Exec: func(context.Context, []string) error {
+			return flag.ErrHelp
+		},
+		Subcommands: []*ffcli.Command{
+			newSinliValidateCommand(),
+			newSinliInspectCommand(),
+			newSinliConvertCommand(),
+			newSinliDiffCommand(),
+		},
+	}
+}
+
+func newSinliValidateCommand() *ffcli.Command {
+	cmd := "validate"
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+
+	return &ffcli.Command{
+		Name:       cmd,
+		ShortUsage: fmt.Sprintf("agorer sinli %s <sinli file>", cmd),
+		ShortHelp:  "check a sinli file against the layout of its document",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return agorer.Validate(ctx, args[0])
+		},
+	}
+}
+
+func newSinliInspectCommand() *ffcli.Command {
+	cmd := "inspect"
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+
+	return &ffcli.Command{
+		Name:       cmd,
+		ShortUsage: fmt.Sprintf("agorer sinli %s <sinli file>", cmd),
+		ShortHelp:  "print the records of a sinli file with their field names",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return agorer.Inspect(ctx, args[0])
+		},
+	}
+}
+
+func newSinliConvertCommand() *ffcli.Command {
+	cmd := "convert"
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+
+	var to, output string
+	fs.StringVar(&to, "to", "json", "output type (json, csv)")
+	fs.StringVar(&output, "output", "", "output file (default stdout)")
+
+	return &ffcli.Command{
+		Name:       cmd,
+		ShortUsage: fmt.Sprintf("agorer sinli %s [flags] <sinli file>", cmd),
+		ShortHelp:  "convert a sinli file to json or csv",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return agorer.Convert(ctx, args[0], to, output)
+		},
+	}
+}
+
+func newSinliDiffCommand() *ffcli.Command {
+	cmd := "diff"
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+
+	var format string
+	fs.StringVar(&format, "format", "text", "output format (text, json)")
+
+	return &ffcli.Command{
+		Name:       cmd,
+		ShortUsage: fmt.Sprintf("agorer sinli %s [flags] <old sinli file> <new sinli file>", cmd),
+		ShortHelp:  "compare the stock or sale details of two sinli files",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return flag.ErrHelp
+			}
+			return agorer.Diff(ctx, args[0], args[1], format)
 		},
 	}
 }
@@ -192,9 +465,24 @@ func newMockServeCommand() *ffcli.Command {
 	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
 	_ = fs.String("config", "", "config file (optional)")
 
-	var addr, master string
+	var addr, master, token string
 	fs.StringVar(&addr, "addr", "", "address to listen to")
-	fs.StringVar(&master, "master", "", "master file")
+	fs.StringVar(&master, "master", "", "master file, day files are read from its directory")
+	fs.StringVar(&token, "token", "", "api token required (optional)")
+
+	// Fault injection parameters
+	var latency time.Duration
+	var failures, errorStatus int
+	var errorRate float64
+	fs.DurationVar(&latency, "latency", 0, "delay of each response")
+	fs.IntVar(&failures, "failures", 0, "number of first requests that fail")
+	fs.IntVar(&errorStatus, "error-status", http.StatusInternalServerError, "status code of failed requests")
+	fs.Float64Var(&errorRate, "error-rate", 0, "fraction of requests that fail randomly, from 0 to 1")
+
+	// Record parameters
+	var record, recordToken string
+	fs.StringVar(&record, "record", "", "agora server URL whose responses are forwarded and saved as master and day files (optional)")
+	fs.StringVar(&recordToken, "record-token", "", "agora token of the recorded server")
 
 	return &ffcli.Command{
 		Name:       cmd,
@@ -207,7 +495,16 @@ func newMockServeCommand() *ffcli.Command {
 		ShortHelp: fmt.Sprintf("%s agorer command", cmd),
 		FlagSet:   fs,
 		Exec: func(ctx context.Context, args []string) error {
-			if _, err := agora.MockServe(ctx, addr, master); err != nil {
+			opts := []agora.MockOption{
+				agora.WithMockToken(token),
+				agora.WithMockLatency(latency),
+				agora.WithMockFailures(errorStatus, failures),
+				agora.WithMockErrorRate(errorStatus, errorRate),
+			}
+			if record != "" {
+				opts = append(opts, agora.WithMockRecord(record, recordToken))
+			}
+			if _, err := agora.MockServe(ctx, addr, master, opts...); err != nil {
 				return err
 			}
 			<-ctx.Done()
@@ -216,6 +513,35 @@ func newMockServeCommand() *ffcli.Command {
 	}
 }
 
+func newAnonymizeCommand() *ffcli.Command {
+	cmd := "anonymize"
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	_ = fs.String("config", "", "config file (optional)")
+
+	var output, key, timezone string
+	fs.StringVar(&output, "output", "", "output directory")
+	fs.StringVar(&key, "key", "", "key to generate pseudonyms, use the same one to keep them consistent between runs (default random)")
+	fs.StringVar(&timezone, "timezone", "Europe/Madrid", "time zone of the store, local if empty")
+
+	return &ffcli.Command{
+		Name:       cmd,
+		ShortUsage: fmt.Sprintf("agorer %s [flags] <agora json files or directories...>", cmd),
+		Options: []ff.Option{
+			ff.WithConfigFileFlag("config"),
+			ff.WithConfigFileParser(ff.PlainParser),
+			ff.WithEnvVarPrefix("AGORER"),
+		},
+		ShortHelp: "replace personal data of agora exports with pseudonyms",
+		FlagSet:   fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return flag.ErrHelp
+			}
+			return agorer.Anonymize(ctx, output, key, timezone, args...)
+		},
+	}
+}
+
 func newExampleCommand() *ffcli.Command {
 	cmd := "example"
 	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
@@ -231,6 +557,10 @@ func newExampleCommand() *ffcli.Command {
 	fs.StringVar(&cfg.MasterFile, "master-file", "", "master file")
 	fs.StringVar(&cfg.DayFile, "day-file", "", "day file")
 	fs.StringVar(&cfg.OutputDir, "data", "", "output dir")
+	fs.StringVar(&cfg.DeliveryPointsFile, "delivery-points", "", "json file with delivery points by workplace id (optional)")
+	fs.StringVar(&cfg.Fallback, "fallback", "", "fallback for characters that can't be encoded (transliterate, replace), fails if empty")
+	var timezone string
+	fs.StringVar(&timezone, "timezone", "Europe/Madrid", "time zone of the store, local if empty")
 
 	return &ffcli.Command{
 		Name:       cmd,
@@ -243,6 +573,11 @@ func newExampleCommand() *ffcli.Command {
 		ShortHelp: fmt.Sprintf("%s agorer command", cmd),
 		FlagSet:   fs,
 		Exec: func(ctx context.Context, args []string) error {
+			loc, err := agora.LoadLocation(timezone)
+			if err != nil {
+				return err
+			}
+			cfg.Location = loc
 			return example.Run(ctx, &cfg)
 		},
 	}
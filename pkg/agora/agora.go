@@ -2,36 +2,160 @@ package agora
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
-type client struct {
-	host   string
-	token  string
-	client *http.Client
-	logDir string
+// API exports data from an Agora server.
+type API interface {
+	// ExportDay exports the invoices and close outs of a business day.
+	ExportDay(ctx context.Context, date time.Time) (*Day, error)
+	// ExportDays exports the business days from one date to another, both
+	// included, returned in order.
+	ExportDays(ctx context.Context, from, to time.Time) ([]*Day, error)
+	// ExportMaster exports the master data, optionally filtered by type.
+	ExportMaster(ctx context.Context, filters ...string) (*Master, error)
 }
 
-func New(host, token string, logDir string) *client {
-	return &client{
-		host:  host,
-		token: token,
-		client: &http.Client{
-			Timeout: 1 * time.Minute,
-		},
-		logDir: logDir,
+var _ API = (*Client)(nil)
+
+// Client is a client of the Agora API.
+type Client struct {
+	host      string
+	token     string
+	client    *http.Client
+	timeout   time.Duration
+	userAgent string
+	logger    *log.Logger
+	// Directory where responses are archived, skipped if empty
+	archiveDir string
+	// Retries of transient failures, with exponential backoff
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	// Concurrent requests of ExportDays
+	workers int
+	// Time zone of the store
+	location *time.Location
+}
+
+// Option configures the client.
+type Option func(*Client)
+
+// WithHTTPClient sets the http client used to make requests, for example to
+// use a custom transport.
+// A nil client is ignored.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		if client != nil {
+			c.client = client
+		}
+	}
+}
+
+// WithTimeout sets the timeout of the requests, defaults to 1 minute.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithUserAgent sets the user agent header of the requests.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithLogger sets the logger of the requests, defaults to the standard
+// logger.
+func WithLogger(logger *log.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithArchiveDir sets the directory where the body of each response is
+// written.
+func WithArchiveDir(dir string) Option {
+	return func(c *Client) {
+		c.archiveDir = dir
 	}
 }
 
-func (c *client) ExportDay(ctx context.Context, date time.Time) (*Day, error) {
+// WithRetries sets the number of times a request is retried after a
+// transient failure, like a refused connection, a timeout or a 5xx status.
+// Requests aren't retried by default.
+func WithRetries(retries int) Option {
+	return func(c *Client) {
+		c.retries = retries
+	}
+}
+
+// WithBackoff sets the wait before the first retry, which is doubled on each
+// retry up to max.
+// Defaults to 1 second and 30 seconds.
+func WithBackoff(backoff, max time.Duration) Option {
+	return func(c *Client) {
+		c.backoff = backoff
+		c.maxBackoff = max
+	}
+}
+
+// WithWorkers sets the number of days exported concurrently by ExportDays,
+// defaults to 4.
+func WithWorkers(workers int) Option {
+	return func(c *Client) {
+		c.workers = workers
+	}
+}
+
+// WithLocation sets the time zone of the store, used to read the timestamps
+// of the exports, which don't include it.
+// Defaults to the local time zone, a nil location is ignored.
+func WithLocation(loc *time.Location) Option {
+	return func(c *Client) {
+		if loc != nil {
+			c.location = loc
+		}
+	}
+}
+
+// New returns a client for the Agora server at host, authenticated with the
+// api token.
+func New(host, token string, opts ...Option) *Client {
+	c := &Client{
+		host:       strings.TrimSuffix(host, "/"),
+		token:      token,
+		client:     &http.Client{},
+		timeout:    1 * time.Minute,
+		logger:     log.Default(),
+		backoff:    1 * time.Second,
+		maxBackoff: 30 * time.Second,
+		workers:    4,
+		location:   time.Local,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	// Copy the http client so the one provided isn't modified
+	client := *c.client
+	client.Timeout = c.timeout
+	c.client = &client
+	return c
+}
+
+func (c *Client) ExportDay(ctx context.Context, date time.Time) (*Day, error) {
 	var day Day
 	businessDay := date.Format("2006-01-02")
 	path := fmt.Sprintf("export?business-day=%s", businessDay)
@@ -41,7 +165,73 @@ func (c *client) ExportDay(ctx context.Context, date time.Time) (*Day, error) {
 	return &day, nil
 }
 
-func (c *client) ExportMaster(ctx context.Context, filters ...string) (*Master, error) {
+// ExportDays exports the business days from one date to another, both
+// included, making concurrent requests.
+// Days are returned in order.
+func (c *Client) ExportDays(ctx context.Context, from, to time.Time) ([]*Day, error) {
+	return ExportDays(ctx, c, from, to, c.workers)
+}
+
+// ExportDays exports the business days from one date to another, both
+// included, using a pool of workers.
+// Days are returned in order, the first error cancels the pending requests.
+func ExportDays(ctx context.Context, api API, from, to time.Time, workers int) ([]*Day, error) {
+	var dates []time.Time
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	days := make([]*Day, len(dates))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for w := 0; w < workers && w < len(dates); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				day, err := api.ExportDay(ctx, dates[i])
+				if err != nil {
+					// Only the first error is kept, the requests in flight
+					// fail too when they are canceled because of it
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("agora: couldn't export day %s: %w", dates[i].Format("2006-01-02"), err)
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				days[i] = day
+			}
+		}()
+	}
+	for i := range dates {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	// Pending days weren't requested if the parent context is done
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("agora: couldn't export days: %w", err)
+	}
+	return days, nil
+}
+
+func (c *Client) ExportMaster(ctx context.Context, filters ...string) (*Master, error) {
 	var master Master
 	var filter string
 	if len(filters) > 0 {
@@ -54,7 +244,70 @@ func (c *client) ExportMaster(ctx context.Context, filters ...string) (*Master,
 	return &master, nil
 }
 
-func (c *client) do(ctx context.Context, path string, out any) error {
+// APIError is returned when the server responds with an unexpected status
+// code.
+type APIError struct {
+	StatusCode int
+	Path       string
+	// Body of the response, truncated
+	Body string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("agora: %s: unexpected status code %d: %s", e.Path, e.StatusCode, e.Body)
+}
+
+// Unauthorized returns true if the api token was rejected.
+func (e *APIError) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// Temporary returns true if the server failed and the request may succeed if
+// retried.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Maximum length of the body of an APIError
+const maxErrorBody = 512
+
+// do makes the request, retrying transient failures until the context is
+// done.
+func (c *Client) do(ctx context.Context, path string, out any) error {
+	backoff := c.backoff
+	for retry := 0; ; retry++ {
+		err := c.request(ctx, path, out)
+		if err == nil || retry >= c.retries || ctx.Err() != nil || !temporary(err) {
+			return err
+		}
+		c.logger.Printf("agora: retrying in %s (%d/%d): %v", backoff, retry+1, c.retries, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("agora: couldn't retry request: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// temporary returns true if the error is a transient failure.
+func temporary(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (c *Client) request(ctx context.Context, path string, out any) error {
 	u := fmt.Sprintf("%s/api/%s", c.host, path)
 	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
@@ -62,8 +315,11 @@ func (c *client) do(ctx context.Context, path string, out any) error {
 	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Api-Token", c.token)
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
 
-	log.Println("agora: request", u)
+	c.logger.Println("agora: request", u)
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("agora: couldn't make request: %w", err)
@@ -75,22 +331,31 @@ func (c *client) do(ctx context.Context, path string, out any) error {
 		return fmt.Errorf("agora: couldn't read response body: %w", err)
 	}
 
-	// Write response body to log file
-	f := strings.Trim(path, "/")
-	f = strings.ReplaceAll(f, "/", "-")
-	f = strings.ReplaceAll(f, "?", "-")
-	f = strings.ReplaceAll(f, "=", "-")
-	f = filepath.Join(c.logDir, fmt.Sprintf("%s_%s.json", f, time.Now().Format("20060102_150405")))
-	if err := os.WriteFile(f, body, 0644); err != nil {
-		log.Println(fmt.Errorf("agora: couldn't write file: %w", err))
+	// Write response body to the archive
+	if c.archiveDir != "" {
+		f := strings.Trim(path, "/")
+		f = strings.ReplaceAll(f, "/", "-")
+		f = strings.ReplaceAll(f, "?", "-")
+		f = strings.ReplaceAll(f, "=", "-")
+		f = filepath.Join(c.archiveDir, fmt.Sprintf("%s_%s.json", f, time.Now().Format("20060102_150405")))
+		if err := os.WriteFile(f, body, 0644); err != nil {
+			c.logger.Println(fmt.Errorf("agora: couldn't write file: %w", err))
+		}
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Println(string(body))
-		return fmt.Errorf("agora: unexpected status code: %d", resp.StatusCode)
+		text := string(body)
+		if len(text) > maxErrorBody {
+			text = strings.ToValidUTF8(text[:maxErrorBody], "") + "..."
+		}
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Path:       path,
+			Body:       text,
+		}
 	}
 
-	if err := json.Unmarshal(body, out); err != nil {
+	if err := Unmarshal(body, out, c.location); err != nil {
 		return fmt.Errorf("agora: couldn't unmarshal json: %w", err)
 	}
 	return nil
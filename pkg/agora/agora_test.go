@@ -0,0 +1,234 @@
+package agora
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Api-Token"); got != "token" {
+			t.Errorf("want token, got %s", got)
+		}
+		if got := r.Header.Get("User-Agent"); got != "agorer-test" {
+			t.Errorf("want agorer-test, got %s", got)
+		}
+		if got := r.URL.Query().Get("business-day"); got != "2023-02-28" {
+			t.Errorf("want 2023-02-28, got %s", got)
+		}
+		_, _ = w.Write([]byte(`{"Invoices":[{"Serie":"T","Number":12}]}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	client := New(srv.URL, "token",
+		WithHTTPClient(srv.Client()),
+		WithTimeout(5*time.Second),
+		WithUserAgent("agorer-test"),
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithArchiveDir(dir),
+	)
+	day, err := client.ExportDay(context.Background(), time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(day.Invoices) != 1 || day.Invoices[0].Number != 12 {
+		t.Fatalf("unexpected day %+v", day)
+	}
+
+	// The response is archived
+	files, err := filepath.Glob(filepath.Join(dir, "export-business-day-2023-02-28_*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("want 1 archived file, got %d", len(files))
+	}
+	if _, err := os.ReadFile(files[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The provided http client isn't modified
+	if srv.Client().Timeout != 0 {
+		t.Fatalf("want no timeout, got %s", srv.Client().Timeout)
+	}
+
+	// A nil http client is ignored
+	client = New(srv.URL, "token", WithHTTPClient(nil), WithUserAgent("agorer-test"))
+	if _, err := client.ExportDay(context.Background(), time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "starting up", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, "token",
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithRetries(3),
+		WithBackoff(time.Millisecond, 2*time.Millisecond),
+	)
+	if _, err := client.ExportMaster(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("want 3 calls, got %d", n)
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, strings.Repeat("x", 1000), http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, "bad",
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithRetries(3),
+		WithBackoff(time.Millisecond, time.Millisecond),
+	)
+	_, err := client.ExportMaster(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("want *APIError, got %v", err)
+	}
+	if !apiErr.Unauthorized() {
+		t.Fatalf("want unauthorized, got %d", apiErr.StatusCode)
+	}
+	if apiErr.Path != "export-master/" {
+		t.Fatalf("want export-master/, got %s", apiErr.Path)
+	}
+	if len(apiErr.Body) != maxErrorBody+len("...") {
+		t.Fatalf("want truncated body, got %d bytes", len(apiErr.Body))
+	}
+	// Auth failures aren't retried
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("want 1 call, got %d", n)
+	}
+}
+
+func TestClientCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, "token",
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithRetries(10),
+		WithBackoff(time.Hour, time.Hour),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.ExportMaster(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+}
+
+type fakeAPI struct {
+	mu      sync.Mutex
+	running int
+	max     int
+	fail    string
+	// Days that don't fail wait until they are canceled
+	wait bool
+}
+
+func (f *fakeAPI) ExportDay(ctx context.Context, date time.Time) (*Day, error) {
+	f.mu.Lock()
+	f.running++
+	if f.running > f.max {
+		f.max = f.running
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.running--
+		f.mu.Unlock()
+	}()
+	if date.Format("2006-01-02") == f.fail {
+		return nil, &APIError{StatusCode: http.StatusUnauthorized, Path: "export"}
+	}
+	if f.wait {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	time.Sleep(5 * time.Millisecond)
+	return &Day{Invoices: []Invoice{{BusinessDay: Date{date}}}}, nil
+}
+
+func (f *fakeAPI) ExportDays(ctx context.Context, from, to time.Time) ([]*Day, error) {
+	return ExportDays(ctx, f, from, to, 1)
+}
+
+func (f *fakeAPI) ExportMaster(ctx context.Context, filters ...string) (*Master, error) {
+	return &Master{}, nil
+}
+
+func TestExportDays(t *testing.T) {
+	from := time.Date(2023, 2, 20, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	api := &fakeAPI{}
+	days, err := ExportDays(context.Background(), api, from, to, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 10 {
+		t.Fatalf("want 10 days, got %d", len(days))
+	}
+	for i, d := range days {
+		want := from.AddDate(0, 0, i).Format("2006-01-02")
+		if got := d.Invoices[0].BusinessDay.Format("2006-01-02"); got != want {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+	if api.max > 3 {
+		t.Fatalf("want at most 3 concurrent requests, got %d", api.max)
+	}
+
+	api = &fakeAPI{fail: "2023-02-25"}
+	if _, err := ExportDays(context.Background(), api, from, to, 3); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	// The failure is returned instead of the cancellation of earlier days
+	api = &fakeAPI{fail: "2023-02-22", wait: true}
+	_, err = ExportDays(context.Background(), api, from, to, 3)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.Unauthorized() {
+		t.Fatalf("want unauthorized *APIError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "2023-02-22") {
+		t.Fatalf("want error of 2023-02-22, got %v", err)
+	}
+
+	// Canceling the parent context is reported
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ExportDays(ctx, &fakeAPI{}, from, to, 3); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context canceled, got %v", err)
+	}
+}
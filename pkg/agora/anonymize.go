@@ -0,0 +1,196 @@
+package agora
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Anonymizer replaces the personal data of master and day exports with
+// pseudonyms.
+// Pseudonyms are derived from a key, so the same value gets the same pseudonym
+// in all the exports anonymized with the same key and references between them
+// stay valid.
+// Products, barcodes and prices aren't modified.
+// Fields that aren't modelled in the export types are lost when the exports
+// are decoded, which also prevents leaking the personal data they may hold.
+type Anonymizer struct {
+	key []byte
+	// Pseudonymized user IDs and their originals, to avoid collisions
+	users    map[int]int
+	usedUser map[int]int
+}
+
+// NewAnonymizer returns an anonymizer using the key, a random key is
+// generated if it's empty.
+func NewAnonymizer(key string) (*Anonymizer, error) {
+	k := []byte(key)
+	if len(k) == 0 {
+		k = make([]byte, 32)
+		if _, err := rand.Read(k); err != nil {
+			return nil, fmt.Errorf("agora: couldn't generate key: %w", err)
+		}
+	}
+	return &Anonymizer{
+		key:      k,
+		users:    map[int]int{},
+		usedUser: map[int]int{},
+	}, nil
+}
+
+// hash returns the keyed hash of the value of a kind of data.
+func (a *Anonymizer) hash(kind, value string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// text returns a pseudonym like `Customer 1a2b3c4d`, or an empty string if
+// the value is empty.
+func (a *Anonymizer) text(kind, value string) string {
+	if value == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s %s", kind, hex.EncodeToString(a.hash(kind, value))[:8])
+}
+
+// digits returns a pseudonym with the same length as the value, replacing
+// digits with digits and letters with upper case letters.
+func (a *Anonymizer) digits(kind, value string) string {
+	h := a.hash(kind, value)
+	var sb strings.Builder
+	for i, c := range value {
+		b := h[i%len(h)]
+		switch {
+		case c >= '0' && c <= '9':
+			sb.WriteByte('0' + b%10)
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			sb.WriteByte('A' + b%26)
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// email returns a pseudonymized email of the example.com domain.
+func (a *Anonymizer) email(value string) string {
+	if value == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s@example.com", hex.EncodeToString(a.hash("email", value))[:8])
+}
+
+// user returns the pseudonymized user ID, zero is kept as it means no user.
+// If another user already got the same ID, it's hashed again with an
+// attempt counter, so the pseudonym of a user only depends on the key unless
+// it collides with another one, which is unlikely with the usual number of
+// users.
+func (a *Anonymizer) user(id int) int {
+	if id == 0 {
+		return 0
+	}
+	if u, ok := a.users[id]; ok {
+		return u
+	}
+	var u int
+	for attempt := 0; ; attempt++ {
+		u = a.userCandidate(id, attempt)
+		if orig, ok := a.usedUser[u]; !ok || orig == id {
+			break
+		}
+	}
+	a.users[id] = u
+	a.usedUser[u] = id
+	return u
+}
+
+// userCandidate returns the pseudonymized user ID of an attempt, a number of
+// 6 digits.
+func (a *Anonymizer) userCandidate(id, attempt int) int {
+	value := fmt.Sprint(id)
+	if attempt > 0 {
+		value = fmt.Sprintf("%d/%d", id, attempt)
+	}
+	h := a.hash("user", value)
+	return int(binary.BigEndian.Uint32(h)%900000) + 100000
+}
+
+// userName returns the pseudonymized name of a user, derived from its ID so it
+// matches in master and day exports.
+func (a *Anonymizer) userName(id int, name string) string {
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf("User %d", a.user(id))
+}
+
+// Master anonymizes users and customers of the master export.
+func (a *Anonymizer) Master(m *Master) {
+	for i := range m.Users {
+		u := &m.Users[i]
+		u.Name = a.userName(u.ID, u.Name)
+		u.ID = a.user(u.ID)
+	}
+	for i := range m.Customers {
+		c := &m.Customers[i]
+		c.FiscalName = a.text("Customer", c.FiscalName)
+		c.BusinessName = a.text("Customer", c.BusinessName)
+		c.Cif = a.digits("cif", c.Cif)
+		c.Street = a.text("Street", c.Street)
+		c.City = a.text("City", c.City)
+		c.Region = a.text("Region", c.Region)
+		c.ZipCode = a.digits("zip", c.ZipCode)
+		c.Telephone = a.digits("telephone", c.Telephone)
+		c.Email = a.email(c.Email)
+		c.AccountCode = a.digits("account", c.AccountCode)
+		c.CardNumber = a.digits("card", c.CardNumber)
+		c.Notes = a.text("Notes", c.Notes)
+	}
+}
+
+// Day anonymizes users, ticketbai data, payment information and free texts of
+// the day export.
+func (a *Anonymizer) Day(d *Day) {
+	for i := range d.Invoices {
+		inv := &d.Invoices[i]
+		inv.User.Name = a.userName(inv.User.ID, inv.User.Name)
+		inv.User.ID = a.user(inv.User.ID)
+		inv.TicketBAIData = a.text("TBAI", inv.TicketBAIData)
+		for j := range inv.InvoiceItems {
+			item := &inv.InvoiceItems[j]
+			item.User.Name = a.userName(item.User.ID, item.User.Name)
+			item.User.ID = a.user(item.User.ID)
+			// Payments of the items aren't modelled and may hold personal
+			// data, so they are removed
+			item.Payments = nil
+			for k := range item.Lines {
+				line := &item.Lines[k]
+				line.UserID = a.user(line.UserID)
+				line.Notes = a.text("Notes", line.Notes)
+			}
+		}
+		for j := range inv.Payments {
+			p := &inv.Payments[j]
+			p.ExtraInformation = a.text("Payment", p.ExtraInformation)
+		}
+	}
+	for i := range d.PosCloseOuts {
+		c := &d.PosCloseOuts[i]
+		c.OpenerUserId = a.user(c.OpenerUserId)
+		c.CloserUserId = a.user(c.CloserUserId)
+		c.Incident = a.text("Incident", c.Incident)
+		c.VerificationCode = a.digits("verification", c.VerificationCode)
+	}
+	for i := range d.SystemCloseOuts {
+		c := &d.SystemCloseOuts[i]
+		c.OpenerUserId = a.user(c.OpenerUserId)
+		c.CloserUserId = a.user(c.CloserUserId)
+	}
+}
@@ -0,0 +1,120 @@
+package agora
+
+import (
+	"testing"
+
+	"github.com/igolaizola/agorer/pkg/money"
+)
+
+func TestAnonymizer(t *testing.T) {
+	master := &Master{
+		Users:     []User{{ID: 1, Name: "Ane"}, {ID: 2, Name: "Jon"}},
+		Customers: []Customer{{ID: 1, FiscalName: "Jon Doe", Cif: "12345678Z", Email: "jon@doe.com", Telephone: "+34 600 000 000"}},
+		Products:  []Product{{ID: 1, Name: "V for Vendetta", CostPrice: money.New(10), Barcodes: []ProductBarcode{{Value: "9781779511195"}}}},
+	}
+	day := &Day{
+		Invoices: []Invoice{{
+			User:          IDName{ID: 2, Name: "Jon"},
+			TicketBAIData: "TBAI-12345678Z-280223-abc",
+			InvoiceItems: []InvoiceItem{{
+				User:  IDName{ID: 2, Name: "Jon"},
+				Lines: []InvoiceItemLine{{UserID: 2, ProductID: 1, ProductPrice: money.New(20)}},
+			}},
+			Payments: []InvoicePayment{{MethodName: "Tarjeta", ExtraInformation: "**** 1234"}},
+		}},
+		PosCloseOuts: []PosCloseOut{{OpenerUserId: 1, CloserUserId: 2}},
+	}
+
+	a, err := NewAnonymizer("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Master(master)
+	a.Day(day)
+
+	u1, u2 := master.Users[0], master.Users[1]
+	if u1.ID == 1 || u1.Name == "Ane" || u1.ID == u2.ID {
+		t.Fatalf("users not anonymized %+v", master.Users)
+	}
+	inv := day.Invoices[0]
+	if inv.User.ID != u2.ID || inv.User.Name != u2.Name {
+		t.Fatalf("want user %+v, got %+v", u2, inv.User)
+	}
+	if inv.InvoiceItems[0].User != inv.User || inv.InvoiceItems[0].Lines[0].UserID != u2.ID {
+		t.Fatalf("inconsistent item user %+v", inv.InvoiceItems[0])
+	}
+	if c := day.PosCloseOuts[0]; c.OpenerUserId != u1.ID || c.CloserUserId != u2.ID {
+		t.Fatalf("inconsistent close out users %+v", c)
+	}
+
+	c := master.Customers[0]
+	if c.FiscalName == "Jon Doe" || c.Email == "jon@doe.com" || c.Cif == "12345678Z" {
+		t.Fatalf("customer not anonymized %+v", c)
+	}
+	if len(c.Cif) != len("12345678Z") || len(c.Telephone) != len("+34 600 000 000") {
+		t.Fatalf("customer formats not kept %+v", c)
+	}
+	if inv.TicketBAIData == "TBAI-12345678Z-280223-abc" || inv.Payments[0].ExtraInformation == "**** 1234" {
+		t.Fatalf("invoice not anonymized %+v", inv)
+	}
+
+	// Products and prices are kept
+	p := master.Products[0]
+	if p.Barcode() != "9781779511195" || p.CostPrice != money.New(10) || inv.InvoiceItems[0].Lines[0].ProductPrice != money.New(20) {
+		t.Fatalf("product modified %+v", p)
+	}
+
+	// Another anonymizer with the same key generates the same pseudonyms
+	b, err := NewAnonymizer("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &Master{Users: []User{{ID: 2, Name: "Jon"}}}
+	b.Master(other)
+	if other.Users[0] != u2 {
+		t.Fatalf("want %+v, got %+v", u2, other.Users[0])
+	}
+}
+
+func TestAnonymizerUserCollision(t *testing.T) {
+	a, err := NewAnonymizer("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Find two user IDs with the same pseudonym
+	first, second := 0, 0
+	seen := map[int]int{}
+	for id := 1; second == 0; id++ {
+		u := a.userCandidate(id, 0)
+		if other, ok := seen[u]; ok {
+			first, second = other, id
+		}
+		seen[u] = id
+	}
+
+	// The second one is hashed again instead of taking a consecutive ID
+	if u := a.user(first); u != a.userCandidate(first, 0) {
+		t.Fatalf("want %d, got %d", a.userCandidate(first, 0), u)
+	}
+	want := a.userCandidate(second, 1)
+	if u := a.user(second); u != want {
+		t.Fatalf("want %d, got %d", want, u)
+	}
+	if a.user(first) == a.user(second) {
+		t.Fatal("users collide")
+	}
+
+	// Pseudonyms don't depend on the other users that don't collide
+	b, err := NewAnonymizer("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := 1; id < 100; id++ {
+		if id != first && id != second {
+			b.user(id)
+		}
+	}
+	if u := b.user(first); u != a.user(first) {
+		t.Fatalf("want %d, got %d", a.user(first), u)
+	}
+}
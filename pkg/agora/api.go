@@ -1,6 +1,10 @@
 package agora
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/igolaizola/agorer/pkg/money"
+)
 
 type IDName struct {
 	ID   int    `json:"Id"`
@@ -8,8 +12,8 @@ type IDName struct {
 }
 
 type MethodAmount struct {
-	MethodName string  `json:"MethodName"`
-	Amount     float32 `json:"Amount"`
+	MethodName string       `json:"MethodName"`
+	Amount     money.Amount `json:"Amount"`
 }
 
 type Day struct {
@@ -21,9 +25,9 @@ type Day struct {
 type Invoice struct {
 	Serie         string           `json:"Serie"`
 	Number        int              `json:"Number"`
-	BusinessDay   string           `json:"BusinessDay"`
+	BusinessDay   Date             `json:"BusinessDay"`
 	VatIncluded   bool             `json:"VatIncluded"`
-	Date          string           `json:"Date"`
+	Date          Time             `json:"Date"`
 	Pos           IDName           `json:"Pos"`
 	Workplace     IDName           `json:"Workplace"`
 	User          IDName           `json:"User"`
@@ -39,9 +43,9 @@ type InvoiceItem struct {
 	Pos         IDName            `json:"Pos"`
 	User        IDName            `json:"User"`
 	GlobalID    string            `json:"GlobalId"`
-	BusinessDay string            `json:"BusinessDay"`
+	BusinessDay Date              `json:"BusinessDay"`
 	PriceList   IDName            `json:"PriceList"`
-	Date        string            `json:"Date"`
+	Date        Time              `json:"Date"`
 	Lines       []InvoiceItemLine `json:"Lines"`
 	Discounts   InvoiceDiscount   `json:"Discounts"`
 	Payments    []any             `json:"Payments"`
@@ -51,90 +55,90 @@ type InvoiceItem struct {
 }
 
 type InvoiceItemLine struct {
-	Index         int     `json:"Index"`
-	CreationDate  string  `json:"CreationDate"`
-	UserID        int     `json:"UserId"`
-	ProductID     int     `json:"ProductId"`
-	ProductName   string  `json:"ProductName"`
-	ProductPrice  float32 `json:"ProductPrice"`
-	FamilyID      int     `json:"FamilyId"`
-	FamilyName    string  `json:"FamilyName"`
-	VatID         int     `json:"VatId"`
-	VatRate       float32 `json:"VatRate"`
-	SurchargeRate float32 `json:"SurchargeRate"`
-	Quantity      float32 `json:"Quantity"`
-	UnitPrice     float32 `json:"UnitPrice"`
-	DiscountRate  float32 `json:"DiscountRate"`
-	CashDiscount  float32 `json:"CashDiscount"`
-	TotalAmount   float32 `json:"TotalAmount"`
-	UnitCostPrice float32 `json:"UnitCostPrice"`
-	OfferID       any     `json:"OfferId"`
-	OfferCode     string  `json:"OfferCode"`
-	Notes         string  `json:"Notes"`
+	Index         int          `json:"Index"`
+	CreationDate  Time         `json:"CreationDate"`
+	UserID        int          `json:"UserId"`
+	ProductID     int          `json:"ProductId"`
+	ProductName   string       `json:"ProductName"`
+	ProductPrice  money.Amount `json:"ProductPrice"`
+	FamilyID      int          `json:"FamilyId"`
+	FamilyName    string       `json:"FamilyName"`
+	VatID         int          `json:"VatId"`
+	VatRate       float32      `json:"VatRate"`
+	SurchargeRate float32      `json:"SurchargeRate"`
+	Quantity      float32      `json:"Quantity"`
+	UnitPrice     money.Amount `json:"UnitPrice"`
+	DiscountRate  float32      `json:"DiscountRate"`
+	CashDiscount  money.Amount `json:"CashDiscount"`
+	TotalAmount   money.Amount `json:"TotalAmount"`
+	UnitCostPrice money.Amount `json:"UnitCostPrice"`
+	OfferID       any          `json:"OfferId"`
+	OfferCode     string       `json:"OfferCode"`
+	Notes         string       `json:"Notes"`
 }
 
 type InvoiceTotals struct {
-	GrossAmount     float32      `json:"GrossAmount"`
-	NetAmount       float32      `json:"NetAmount"`
-	VatAmount       float32      `json:"VatAmount"`
-	SurchargeAmount float32      `json:"SuperchargeAmount"`
+	GrossAmount     money.Amount `json:"GrossAmount"`
+	NetAmount       money.Amount `json:"NetAmount"`
+	VatAmount       money.Amount `json:"VatAmount"`
+	SurchargeAmount money.Amount `json:"SuperchargeAmount"`
 	Taxes           []InvoiceTax `json:"Taxes"`
 }
 
 type InvoicePayment struct {
-	MethodID         int     `json:"MethodId"`
-	MethodName       string  `json:"MethodName"`
-	Amount           float32 `json:"Amount"`
-	PaidAmount       float32 `json:"PaidAmount"`
-	ChangeAmount     float32 `json:"ChangeAmount"`
-	Date             string  `json:"Date"`
-	PosID            int     `json:"PosId"`
-	IsPrepayment     bool    `json:"IsPrepayment"`
-	ExtraInformation string  `json:"ExtraInformation"`
+	MethodID         int          `json:"MethodId"`
+	MethodName       string       `json:"MethodName"`
+	Amount           money.Amount `json:"Amount"`
+	PaidAmount       money.Amount `json:"PaidAmount"`
+	ChangeAmount     money.Amount `json:"ChangeAmount"`
+	Date             Time         `json:"Date"`
+	PosID            int          `json:"PosId"`
+	IsPrepayment     bool         `json:"IsPrepayment"`
+	ExtraInformation string       `json:"ExtraInformation"`
 }
 
 type InvoiceTax struct {
-	VatRate         float32 `json:"VatRate"`
-	SurchargeRate   float32 `json:"SurchargeRate"`
-	NetAmount       float32 `json:"NetAmount"`
-	VatAmount       float32 `json:"VatAmount"`
-	SurchargeAmount float32 `json:"SurchargeAmount"`
+	VatRate         float32      `json:"VatRate"`
+	SurchargeRate   float32      `json:"SurchargeRate"`
+	NetAmount       money.Amount `json:"NetAmount"`
+	VatAmount       money.Amount `json:"VatAmount"`
+	SurchargeAmount money.Amount `json:"SurchargeAmount"`
 }
 
 type InvoiceDiscount struct {
-	DiscountRate float32 `json:"DiscountRate"`
-	CashDiscount float32 `json:"CashDiscount"`
+	DiscountRate float32      `json:"DiscountRate"`
+	CashDiscount money.Amount `json:"CashDiscount"`
 }
 
 type PosCloseOut struct {
 	ID                int                  `json:"Id"`
 	PosID             int                  `json:"PosId"`
 	WorkplaceID       int                  `json:"WorkplaceId"`
-	BusinessDay       string               `json:"BusinessDay"`
-	InitialAmount     float32              `json:"InitialAmount"`
-	ExpectedEndAmount float32              `json:"ExpectedEndAmount"`
-	ActualEndAmount   float32              `json:"ActualEndAmount"`
+	BusinessDay       Date                 `json:"BusinessDay"`
+	InitialAmount     money.Amount         `json:"InitialAmount"`
+	ExpectedEndAmount money.Amount         `json:"ExpectedEndAmount"`
+	ActualEndAmount   money.Amount         `json:"ActualEndAmount"`
 	Incident          string               `json:"Incident"`
-	OpenDate          string               `json:"OpenDate"`
+	OpenDate          Time                 `json:"OpenDate"`
 	OpenerUserId      int                  `json:"OpenerUserId"`
-	CloseDate         string               `json:"CloseDate"`
+	CloseDate         Time                 `json:"CloseDate"`
 	CloserUserId      int                  `json:"CloserUserId"`
 	VerificationCode  string               `json:"VerificationCode"`
 	Balances          []PosCloseOutBalance `json:"Balances"`
 }
 
 type PosCloseOutBalance struct {
-	PaymentMethodID   int     `json:"PaymentMethodId"`
-	InitialAmount     float32 `json:"InitialAmount"`
-	ExpectedEndAmount float32 `json:"ExpectedEndAmount"`
-	ActualEndAmount   float32 `json:"ActualEndAmount"`
+	PaymentMethodID   int          `json:"PaymentMethodId"`
+	InitialAmount     money.Amount `json:"InitialAmount"`
+	ExpectedEndAmount money.Amount `json:"ExpectedEndAmount"`
+	ActualEndAmount   money.Amount `json:"ActualEndAmount"`
 }
 
 type SystemCloseOut struct {
 	Number               int                      `json:"Number"`
-	BusinessDay          string                   `json:"BusinessDay"`
-	OpenDate             string                   `json:"OpenDate"`
-	CloseDate            string                   `json:"CloseDate"`
+	BusinessDay          Date                     `json:"BusinessDay"`
+	OpenDate             Time                     `json:"OpenDate"`
+	CloseDate            Time                     `json:"CloseDate"`
 	OpenerUserId         int                      `json:"OpenerUserId"`
 	CloserUserId         int                      `json:"CloserUserId"`
 	WorkplaceID          int                      `json:"WorkplaceId"`
@@ -147,18 +151,18 @@ type SystemCloseOut struct {
 }
 
 type SystemCloseOutDocument struct {
-	Serie       string  `json:"Serie"`
-	Amount      float32 `json:"Amount"`
-	FirstNumber int     `json:"FirstNumber"`
-	LastNumber  int     `json:"LastNumber"`
-	Count       int     `json:"Count"`
+	Serie       string       `json:"Serie"`
+	Amount      money.Amount `json:"Amount"`
+	FirstNumber int          `json:"FirstNumber"`
+	LastNumber  int          `json:"LastNumber"`
+	Count       int          `json:"Count"`
 }
 
 type SystemCloseOutAmount struct {
-	NetAmount       float32 `json:"NetAmount"`
-	GrossAmount     float32 `json:"GrossAmount"`
-	SurchargeAmount float32 `json:"SurchargeAmount"`
-	VatAmount       float32 `json:"VatAmount"`
+	NetAmount       money.Amount `json:"NetAmount"`
+	GrossAmount     money.Amount `json:"GrossAmount"`
+	SurchargeAmount money.Amount `json:"SurchargeAmount"`
+	VatAmount       money.Amount `json:"VatAmount"`
 }
 
 type Master struct {
@@ -177,6 +181,15 @@ type Master struct {
 }
 
 type WorkplacesSummary struct {
+	ID        int                 `json:"Id"`
+	Name      string              `json:"Name"`
+	PosGroups []WorkplacePosGroup `json:"PosGroups"`
+}
+
+type WorkplacePosGroup struct {
+	ID   int      `json:"Id"`
+	Name string   `json:"Name"`
+	Pos  []IDName `json:"Pos"`
 }
 
 type Vat struct {
@@ -216,24 +229,60 @@ const (
 )
 
 type PriceList struct {
-	ID          int    `json:"Id"`
-	Name        string `json:"Name"`
-	VatIncluded bool   `json:"VatIncluded"`
+	ID           int    `json:"Id"`
+	Name         string `json:"Name"`
+	VatIncluded  bool   `json:"VatIncluded"`
+	DeletionDate string `json:"DeletionDate"`
 }
 
 type User struct {
+	ID           int    `json:"Id"`
+	Name         string `json:"Name"`
+	ProfileID    int    `json:"ProfileId"`
+	DeletionDate string `json:"DeletionDate"`
 }
 
 type PaymentMethod struct {
+	ID               int    `json:"Id"`
+	Name             string `json:"Name"`
+	GiveChange       bool   `json:"GiveChange"`
+	IncludeInBalance bool   `json:"IncludeInBalance"`
+	DeletionDate     string `json:"DeletionDate"`
 }
 
 type Warehouse struct {
+	ID           int    `json:"Id"`
+	Name         string `json:"Name"`
+	DeletionDate string `json:"DeletionDate"`
 }
 
 type Customer struct {
+	ID             int     `json:"Id"`
+	FiscalName     string  `json:"FiscalName"`
+	BusinessName   string  `json:"BusinessName"`
+	Cif            string  `json:"Cif"`
+	Street         string  `json:"Street"`
+	City           string  `json:"City"`
+	Region         string  `json:"Region"`
+	ZipCode        string  `json:"ZipCode"`
+	Telephone      string  `json:"Telephone"`
+	Email          string  `json:"Email"`
+	AccountCode    string  `json:"AccountCode"`
+	CardNumber     string  `json:"CardNumber"`
+	ApplySurcharge bool    `json:"ApplySurcharge"`
+	DiscountRate   float32 `json:"DiscountRate"`
+	PriceListID    *int    `json:"PriceListId"`
+	Notes          string  `json:"Notes"`
+	DeletionDate   string  `json:"DeletionDate"`
 }
 
 type Family struct {
+	ID             int    `json:"Id"`
+	Name           string `json:"Name"`
+	ButtonText     string `json:"ButtonText"`
+	Color          string `json:"Color"`
+	ParentFamilyID *int   `json:"ParentFamilyId"`
+	DeletionDate   string `json:"DeletionDate"`
 }
 
 type Product struct {
@@ -250,7 +299,7 @@ type Product struct {
 	PrintWhenPriceIsZero bool               `json:"PrintWhenPriceIsZero"`
 	SizeGroupID          *int               `json:"SizeGroupId"`
 	ColorGroupID         *int               `json:"ColorGroupId"`
-	CostPrice            float32            `json:"CostPrice"`
+	CostPrice            money.Amount       `json:"CostPrice"`
 	Barcodes             []ProductBarcode   `json:"Barcodes"`
 	StorageOptions       []ProductStorage   `json:"StorageOptions"`
 	Prices               []ProductPrice     `json:"Prices"`
@@ -281,13 +330,13 @@ type ProductStorage struct {
 }
 
 type ProductPrice struct {
-	PriceListID int     `json:"PriceListId"`
-	Price       float32 `json:"Price"`
+	PriceListID int          `json:"PriceListId"`
+	Price       money.Amount `json:"Price"`
 }
 
 type ProductCostPrice struct {
-	WarehouseID int     `json:"WarehouseId"`
-	CostPrice   float32 `json:"CostPrice"`
+	WarehouseID int          `json:"WarehouseId"`
+	CostPrice   money.Amount `json:"CostPrice"`
 }
 
 type Stock struct {
@@ -297,4 +346,17 @@ type Stock struct {
 }
 
 type Supplier struct {
+	ID           int    `json:"Id"`
+	FiscalName   string `json:"FiscalName"`
+	BusinessName string `json:"BusinessName"`
+	Cif          string `json:"Cif"`
+	Street       string `json:"Street"`
+	City         string `json:"City"`
+	Region       string `json:"Region"`
+	ZipCode      string `json:"ZipCode"`
+	Telephone    string `json:"Telephone"`
+	Email        string `json:"Email"`
+	AccountCode  string `json:"AccountCode"`
+	Notes        string `json:"Notes"`
+	DeletionDate string `json:"DeletionDate"`
 }
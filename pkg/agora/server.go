@@ -2,92 +2,353 @@ package agora
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
-func MockServe(ctx context.Context, addr string, masterFile string) (int, error) {
-	master, err := os.ReadFile(masterFile)
-	if err != nil {
-		return 0, fmt.Errorf("couldn't read %s: %w", masterFile, err)
+// MockServer serves a master json file and day json files, named like
+// `2006-01-02.json` and placed in the directory of the master file, as an
+// agora server would.
+type MockServer struct {
+	masterFile string
+	dir        string
+	mux        *http.ServeMux
+	server     *http.Server
+	listener   net.Listener
+	logger     *log.Logger
+
+	// Api token required, not checked if empty
+	token string
+
+	// Faults injected in the responses
+	mu         sync.Mutex
+	latency    time.Duration
+	failStatus int
+	failCount  int
+	errStatus  int
+	errRate    float64
+
+	// Agora server whose responses are recorded
+	recordHost  string
+	recordToken string
+	client      *http.Client
+}
+
+// MockOption configures the mock server.
+type MockOption func(*MockServer)
+
+// WithMockToken sets the api token required by the mock server.
+func WithMockToken(token string) MockOption {
+	return func(s *MockServer) {
+		s.token = token
 	}
+}
 
-	days := map[string][]byte{}
+// WithMockLatency delays each response of the mock server.
+func WithMockLatency(latency time.Duration) MockOption {
+	return func(s *MockServer) {
+		s.latency = latency
+	}
+}
 
-	// Loop all files in master file directory
-	dir := filepath.Dir(masterFile)
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return fmt.Errorf("couldn't walk %s: %w", path, err)
+// WithMockFailures makes the first n requests fail with the status code.
+func WithMockFailures(status, n int) MockOption {
+	return func(s *MockServer) {
+		s.failStatus = status
+		s.failCount = n
+	}
+}
+
+// WithMockErrorRate makes a random fraction of the requests, from 0 to 1,
+// fail with the status code.
+func WithMockErrorRate(status int, rate float64) MockOption {
+	return func(s *MockServer) {
+		s.errStatus = status
+		s.errRate = rate
+	}
+}
+
+// WithMockRecord forwards the requests to the agora server at host and saves
+// its responses as master and day files.
+func WithMockRecord(host, token string) MockOption {
+	return func(s *MockServer) {
+		s.recordHost = strings.TrimSuffix(host, "/")
+		s.recordToken = token
+	}
+}
+
+// WithMockLogger sets the logger of the mock server.
+func WithMockLogger(logger *log.Logger) MockOption {
+	return func(s *MockServer) {
+		s.logger = logger
+	}
+}
+
+// NewMockServer returns a mock server for the master file and the day files
+// of its directory.
+// Files are read on each request, so they can be added while serving.
+func NewMockServer(masterFile string, opts ...MockOption) (*MockServer, error) {
+	if masterFile == "" {
+		return nil, errors.New("agora: master file must be provided")
+	}
+	s := &MockServer{
+		masterFile: masterFile,
+		dir:        filepath.Dir(masterFile),
+		mux:        http.NewServeMux(),
+		logger:     log.Default(),
+		client:     &http.Client{Timeout: 1 * time.Minute},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.recordHost != "" {
+		if err := os.MkdirAll(s.dir, 0755); err != nil {
+			return nil, fmt.Errorf("agora: couldn't create dir %s: %w", s.dir, err)
 		}
-		base := filepath.Base(path)
-		// Skip directories
-		if info.IsDir() {
-			return nil
+	} else if _, err := os.Stat(masterFile); err != nil {
+		return nil, fmt.Errorf("agora: couldn't read %s: %w", masterFile, err)
+	}
+	s.mux.HandleFunc("/api/export-master/", s.handleMaster)
+	s.mux.HandleFunc("/api/export", s.handleDay)
+	return s, nil
+}
+
+// Fail makes the next n requests fail with the status code.
+func (s *MockServer) Fail(status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failStatus = status
+	s.failCount = n
+}
+
+// ServeHTTP serves the request, so the mock server can also be used as a
+// handler, for example with httptest.
+func (s *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(s.latency):
 		}
-		// Check if file json
-		if filepath.Ext(path) != ".json" {
-			return nil
+	}
+	if status := s.fault(); status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if s.token != "" && r.Header.Get("Api-Token") != s.token {
+		http.Error(w, "invalid api token", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// fault returns the status code of the injected failure, if any.
+func (s *MockServer) fault() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failCount > 0 {
+		s.failCount--
+		return s.failStatus
+	}
+	if s.errRate > 0 && rand.Float64() < s.errRate {
+		return s.errStatus
+	}
+	return 0
+}
+
+// Start listens on addr and serves in the background until the server is
+// closed.
+// The port listened is returned.
+func (s *MockServer) Start(addr string) (int, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return 0, fmt.Errorf("agora: couldn't listen on %s: %w", addr, err)
+	}
+	s.listener = l
+	s.server = &http.Server{Handler: s}
+	go func() {
+		if err := s.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Println(fmt.Errorf("agora: couldn't serve: %w", err))
 		}
-		// Check if file name is a date + .json
-		date := base[:len(base)-len(".json")]
-		if _, err := time.Parse("2006-01-02", date); err != nil {
-			return nil
+	}()
+	s.logger.Println("Mocking agora server on", l.Addr().String())
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Close stops the server and closes its connections.
+func (s *MockServer) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	if err := s.server.Close(); err != nil {
+		return fmt.Errorf("agora: couldn't close server: %w", err)
+	}
+	return nil
+}
+
+func (s *MockServer) handleMaster(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+	if s.recordHost != "" {
+		// Only the whole master is recorded
+		file := s.masterFile
+		if filter != "" {
+			file = ""
 		}
-		// Read file
-		b, err := os.ReadFile(path)
+		s.record(w, r, file)
+		return
+	}
+	b, err := os.ReadFile(s.masterFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if filter != "" {
+		b, err = filterMaster(b, strings.Split(filter, ","))
 		if err != nil {
-			return fmt.Errorf("couldn't read %s: %w", path, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		// Add to days map
-		days[date] = b
-		return nil
-	})
-	if err != nil {
-		return 0, fmt.Errorf("couldn't walk %s: %w", dir, err)
 	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
 
-	// Listen on addr
-	l, err := net.Listen("tcp", addr)
+func (s *MockServer) handleDay(w http.ResponseWriter, r *http.Request) {
+	// Read ?business-day=%s query param
+	date := r.URL.Query().Get("business-day")
+	if date == "" {
+		http.Error(w, "missing business-day query param", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		http.Error(w, "invalid business-day query param", http.StatusBadRequest)
+		return
+	}
+	if s.recordHost != "" {
+		s.record(w, r, filepath.Join(s.dir, fmt.Sprintf("%s.json", date)))
+		return
+	}
+	file, err := s.dayFile(date)
 	if err != nil {
-		return 0, fmt.Errorf("couldn't listen on %s: %w", addr, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	if file == "" {
+		http.Error(w, "no data for business-day", http.StatusNotFound)
+		return
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
 
-	// Serve masterFile json file on /export-master endpoint
-	http.HandleFunc("/api/export-master/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write(master)
+// dayFile returns the path of the day file inside the directory of the master
+// file, or an empty path if it doesn't exist.
+func (s *MockServer) dayFile(date string) (string, error) {
+	name := fmt.Sprintf("%s.json", date)
+	var file string
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("couldn't walk %s: %w", path, err)
+		}
+		if info.IsDir() || info.Name() != name {
+			return nil
+		}
+		file = path
+		return filepath.SkipAll
 	})
+	if err != nil {
+		return "", fmt.Errorf("agora: couldn't walk %s: %w", s.dir, err)
+	}
+	return file, nil
+}
 
-	// Serve day json files on /api/export endpoint
-	http.HandleFunc("/api/export", func(w http.ResponseWriter, r *http.Request) {
-		// Read ?business-day=%s query param
-		q := r.URL.Query()
-		date := q.Get("business-day")
-		if date == "" {
-			http.Error(w, "missing business-day query param", http.StatusBadRequest)
-			return
+// record forwards the request to the recorded agora server and saves the
+// response to file, unless it's empty or the request failed.
+func (s *MockServer) record(w http.ResponseWriter, r *http.Request, file string) {
+	u := fmt.Sprintf("%s%s", s.recordHost, r.URL.RequestURI())
+	req, err := http.NewRequestWithContext(r.Context(), "GET", u, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Api-Token", s.recordToken)
+	s.logger.Println("agora: recording", u)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if resp.StatusCode == http.StatusOK && file != "" {
+		if err := os.WriteFile(file, b, 0644); err != nil {
+			s.logger.Println(fmt.Errorf("agora: couldn't write file: %w", err))
 		}
-		b, ok := days[date]
-		if !ok {
-			http.Error(w, "no data for business-day", http.StatusNotFound)
-			return
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(b)
+}
+
+// filterMaster returns the master json with only the entities of the filter.
+func filterMaster(b []byte, filter []string) ([]byte, error) {
+	var master map[string]json.RawMessage
+	if err := json.Unmarshal(b, &master); err != nil {
+		return nil, fmt.Errorf("agora: couldn't unmarshal master: %w", err)
+	}
+	filtered := map[string]json.RawMessage{}
+	for k, v := range master {
+		for _, f := range filter {
+			if strings.EqualFold(k, strings.TrimSpace(f)) {
+				filtered[k] = v
+			}
 		}
-		w.Write(b)
-	})
+	}
+	b, err := json.Marshal(filtered)
+	if err != nil {
+		return nil, fmt.Errorf("agora: couldn't marshal master: %w", err)
+	}
+	return b, nil
+}
 
-	// Serve on addr until ctx is done
-	go func() {
-		http.Serve(l, nil)
-	}()
+// MockServe serves the master file and the day files of its directory on addr
+// until the context is done.
+// The port listened is returned.
+func MockServe(ctx context.Context, addr string, masterFile string, opts ...MockOption) (int, error) {
+	s, err := NewMockServer(masterFile, opts...)
+	if err != nil {
+		return 0, err
+	}
+	port, err := s.Start(addr)
+	if err != nil {
+		return 0, err
+	}
 	go func() {
 		<-ctx.Done()
-		l.Close()
+		_ = s.Close()
 	}()
-	log.Println("Mocking agora server on", l.Addr().String())
-	return l.Addr().(*net.TCPAddr).Port, nil
+	return port, nil
 }
@@ -0,0 +1,171 @@
+package agora
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testMockServer(t *testing.T, opts ...MockOption) (*MockServer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	master := filepath.Join(dir, "master.json")
+	if err := os.WriteFile(master, []byte(`{"Vats":[{"Id":1}],"Products":[{"Id":2}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2023-02-28.json"), []byte(`{"Invoices":[{"Number":12}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts = append([]MockOption{WithMockLogger(log.New(io.Discard, "", 0))}, opts...)
+	s, err := NewMockServer(master, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func TestMockServer(t *testing.T) {
+	s, dir := testMockServer(t, WithMockToken("token"))
+	port, err := s.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := fmt.Sprintf("http://127.0.0.1:%d", port)
+	ctx := context.Background()
+
+	client := New(host, "token", WithLogger(log.New(io.Discard, "", 0)))
+	day, err := client.ExportDay(ctx, time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(day.Invoices) != 1 || day.Invoices[0].Number != 12 {
+		t.Fatalf("unexpected day %+v", day)
+	}
+
+	// Master is filtered
+	master, err := client.ExportMaster(ctx, "Products")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(master.Products) != 1 || len(master.Vats) != 0 {
+		t.Fatalf("unexpected master %+v", master)
+	}
+
+	// Day files added while serving are found
+	if err := os.WriteFile(filepath.Join(dir, "2023-03-01.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ExportDay(ctx, time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Missing days aren't found
+	_, err = client.ExportDay(ctx, time.Date(2023, 3, 2, 0, 0, 0, 0, time.UTC))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("want not found, got %v", err)
+	}
+
+	// Token is checked
+	bad := New(host, "bad", WithLogger(log.New(io.Discard, "", 0)))
+	_, err = bad.ExportMaster(ctx)
+	if !errors.As(err, &apiErr) || !apiErr.Unauthorized() {
+		t.Fatalf("want unauthorized, got %v", err)
+	}
+
+	// A second server can be started in the same process
+	other, _ := testMockServer(t)
+	if _, err := other.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ExportMaster(ctx); err == nil {
+		t.Fatal("expected error after close, got nil")
+	}
+}
+
+func TestMockServerFaults(t *testing.T) {
+	s, _ := testMockServer(t, WithMockFailures(http.StatusInternalServerError, 2))
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	ctx := context.Background()
+
+	client := New(srv.URL, "token",
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithRetries(2),
+		WithBackoff(time.Millisecond, time.Millisecond),
+	)
+	if _, err := client.ExportMaster(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Fail(http.StatusUnauthorized, 1)
+	_, err := client.ExportMaster(ctx)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.Unauthorized() {
+		t.Fatalf("want unauthorized, got %v", err)
+	}
+}
+
+func TestMockServerRecord(t *testing.T) {
+	upstream, _ := testMockServer(t, WithMockToken("real"))
+	up := httptest.NewServer(upstream)
+	defer up.Close()
+
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	master := filepath.Join(dir, "master.json")
+	s, err := NewMockServer(master,
+		WithMockLogger(log.New(io.Discard, "", 0)),
+		WithMockRecord(up.URL, "real"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	ctx := context.Background()
+
+	client := New(srv.URL, "", WithLogger(log.New(io.Discard, "", 0)))
+	if _, err := client.ExportMaster(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ExportDay(ctx, time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ExportDay(ctx, time.Date(2023, 3, 2, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	// Recorded files can be served
+	for _, f := range []string{"master.json", "2023-02-28.json"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2023-03-02.json")); !os.IsNotExist(err) {
+		t.Fatalf("want failed day not recorded, got %v", err)
+	}
+	replay, err := NewMockServer(master, WithMockLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	replay.ServeHTTP(rec, httptest.NewRequest("GET", "/api/export?business-day=2023-02-28", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,156 @@
+package agora
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// LoadLocation returns the time zone of the store by its name, like
+// `Europe/Madrid`, or the local one if the name is empty.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("agora: couldn't load time zone %s: %w", name, err)
+	}
+	return loc, nil
+}
+
+// BusinessDay returns the business day of the store at the time, in the time
+// zone of the store.
+func BusinessDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// Unmarshal decodes the json of an export, reading the timestamps without
+// time zone in the one of the store, the local one if it's nil.
+func Unmarshal(b []byte, v any, loc *time.Location) error {
+	if err := json.Unmarshal(b, v); err != nil {
+		return err
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	setLocation(reflect.ValueOf(v), loc)
+	return nil
+}
+
+// noZone is the time zone of the timestamps decoded without one, until the
+// time zone of the store is set.
+var noZone = time.FixedZone("UTC", 0)
+
+var (
+	timeType = reflect.TypeOf(Time{})
+	dateType = reflect.TypeOf(Date{})
+)
+
+// setLocation sets the time zone of the timestamps without one, keeping
+// their clock.
+func setLocation(v reflect.Value, loc *time.Location) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			setLocation(v.Elem(), loc)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			setLocation(v.Index(i), loc)
+		}
+	case reflect.Struct:
+		if v.Type() == timeType || v.Type() == dateType {
+			t := v.Field(0).Interface().(time.Time)
+			if t.Location() == noZone && v.CanSet() {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+				v.Field(0).Set(reflect.ValueOf(t))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				setLocation(v.Field(i), loc)
+			}
+		}
+	}
+}
+
+const (
+	timeLayout = "2006-01-02T15:04:05"
+	dateLayout = "2006-01-02"
+)
+
+// Time is a timestamp of an agora document, read in the time zone of the
+// store unless it includes its own.
+// Decoding with encoding/json reads timestamps without time zone in UTC, use
+// Unmarshal to read them in the time zone of the store.
+type Time struct {
+	time.Time
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte(`""`), nil
+	}
+	return []byte(fmt.Sprintf("%q", t.Format(time.RFC3339Nano))), nil
+}
+
+func (t *Time) UnmarshalJSON(b []byte) error {
+	v, err := parseTime(b)
+	if err != nil {
+		return err
+	}
+	t.Time = v
+	return nil
+}
+
+// Date is the business day of an agora document, in the time zone of the
+// store.
+type Date struct {
+	time.Time
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte(`""`), nil
+	}
+	return []byte(fmt.Sprintf("%q", d.Format(dateLayout))), nil
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	v, err := parseTime(b)
+	if err != nil {
+		return err
+	}
+	if !v.IsZero() {
+		v = time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, v.Location())
+	}
+	d.Time = v
+	return nil
+}
+
+// parseTime parses a json timestamp with or without time zone, empty or null
+// values are returned as the zero time.
+func parseTime(b []byte) (time.Time, error) {
+	s := string(b)
+	if s == "null" {
+		return time.Time{}, nil
+	}
+	s = strings.Trim(s, `"`)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{timeLayout, dateLayout} {
+		if t, err := time.ParseInLocation(layout, s, noZone); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("agora: couldn't parse time %s", s)
+}
@@ -0,0 +1,144 @@
+package agora
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTime(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var day Day
+	js := `{"Invoices":[{"BusinessDay":"2023-02-28","Date":"2023-02-28T23:30:00.123"}]}`
+	if err := Unmarshal([]byte(js), &day, madrid); err != nil {
+		t.Fatal(err)
+	}
+	inv := day.Invoices[0]
+	want := time.Date(2023, 2, 28, 23, 30, 0, 123000000, madrid)
+	if !inv.Date.Equal(want) || inv.Date.Location() != madrid {
+		t.Fatalf("want %s, got %s", want, inv.Date)
+	}
+	if got := inv.Date.UTC().Format(time.RFC3339); got != "2023-02-28T22:30:00Z" {
+		t.Fatalf("want 2023-02-28T22:30:00Z, got %s", got)
+	}
+	if got := inv.BusinessDay; got.Format(dateLayout) != "2023-02-28" || got.Location() != madrid {
+		t.Fatalf("want 2023-02-28 in Madrid, got %s", got)
+	}
+
+	// Without the time zone of the store timestamps are read in UTC
+	if err := json.Unmarshal([]byte(js), &day); err != nil {
+		t.Fatal(err)
+	}
+	if got := day.Invoices[0].Date.UTC().Format(time.RFC3339); got != "2023-02-28T23:30:00Z" {
+		t.Fatalf("want 2023-02-28T23:30:00Z, got %s", got)
+	}
+
+	// Timestamps with time zone keep it
+	var v Time
+	if err := Unmarshal([]byte(`"2023-02-28T23:30:00Z"`), &v, madrid); err != nil {
+		t.Fatal(err)
+	}
+	if v.Location() != time.UTC {
+		t.Fatalf("want UTC, got %s", v.Location())
+	}
+
+	// Empty values are zero and marshalled as empty
+	if err := Unmarshal([]byte(`{"Date":null,"BusinessDay":""}`), &inv, madrid); err != nil {
+		t.Fatal(err)
+	}
+	if !inv.Date.IsZero() || !inv.BusinessDay.IsZero() {
+		t.Fatalf("want zero, got %s %s", inv.Date, inv.BusinessDay)
+	}
+
+	// Timestamps are marshalled with their offset
+	b, err := json.Marshal(PosCloseOut{
+		BusinessDay: Date{time.Date(2023, 2, 28, 0, 0, 0, 0, madrid)},
+		OpenDate:    Time{time.Date(2023, 2, 28, 9, 0, 0, 0, madrid)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["BusinessDay"] != "2023-02-28" || got["OpenDate"] != "2023-02-28T09:00:00+01:00" || got["CloseDate"] != "" {
+		t.Fatalf("unexpected json %s", b)
+	}
+	var c PosCloseOut
+	if err := Unmarshal(b, &c, time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	if !c.OpenDate.Equal(time.Date(2023, 2, 28, 9, 0, 0, 0, madrid)) {
+		t.Fatalf("want 09:00 in Madrid, got %s", c.OpenDate)
+	}
+
+	if err := json.Unmarshal([]byte(`"28/02/2023"`), &v); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestClientLocation(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skip(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Invoices":[{"Date":"2023-02-28T23:30:00"}]}`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		loc  *time.Location
+		want string
+	}{
+		{madrid, "2023-02-28T22:30:00Z"},
+		{time.UTC, "2023-02-28T23:30:00Z"},
+	}
+	for _, tt := range tests {
+		client := New(srv.URL, "token", WithLocation(tt.loc))
+		day, err := client.ExportDay(context.Background(), time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := day.Invoices[0].Date.UTC().Format(time.RFC3339); got != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.loc, tt.want, got)
+		}
+	}
+}
+
+func TestBusinessDay(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// Past midnight in Madrid is still the previous day in UTC
+	now := time.Date(2023, 2, 28, 23, 30, 0, 0, time.UTC)
+	if got := BusinessDay(now, madrid).Format(dateLayout); got != "2023-03-01" {
+		t.Fatalf("want 2023-03-01, got %s", got)
+	}
+	if got := BusinessDay(now, time.UTC).Format(dateLayout); got != "2023-02-28" {
+		t.Fatalf("want 2023-02-28, got %s", got)
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	loc, err := LoadLocation("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc != time.Local {
+		t.Fatalf("want local, got %s", loc)
+	}
+	if _, err := LoadLocation("Nowhere/Land"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
@@ -26,32 +26,49 @@ type Config struct {
 	MasterFile string
 	DayFile    string
 	OutputDir  string
+	// Time zone of the store used to read the master and day files, the local
+	// one if nil
+	Location *time.Location
+
+	// Agora client used instead of the master and day files
+	Agora agora.API
+	// Business day exported when using the agora client
+	Day time.Time
+
+	// Json file with the delivery points of each workplace ID
+	DeliveryPointsFile string
+	// Fallback for characters that can't be encoded (transliterate, replace)
+	Fallback string
 }
 
 func Run(ctx context.Context, c *Config) error {
-	b, err := os.ReadFile(c.MasterFile)
+	master, day, err := load(ctx, c)
 	if err != nil {
-		return fmt.Errorf("couldn't read %s: %w", c.MasterFile, err)
-	}
-	var master agora.Master
-	if err := json.Unmarshal(b, &master); err != nil {
-		return fmt.Errorf("couldn't unmarshal master: %w", err)
+		return err
 	}
 
-	b, err = os.ReadFile(c.DayFile)
-	if err != nil {
-		return fmt.Errorf("couldn't read %s: %w", c.DayFile, err)
-	}
-	var day agora.Day
-	if err := json.Unmarshal(b, &day); err != nil {
-		return fmt.Errorf("couldn't unmarshal %s: %w", c.DayFile, err)
+	var deliveryPoints map[int]agorer.DeliveryPoint
+	if c.DeliveryPointsFile != "" {
+		deliveryPoints, err = agorer.LoadDeliveryPoints(c.DeliveryPointsFile)
+		if err != nil {
+			return err
+		}
 	}
 
 	isbnClient, err := isbn.New("data/isbn.json", "data/isbn_err.json")
 	if err != nil {
 		return fmt.Errorf("couldn't create isbn client: %w", err)
 	}
-	s := agorer.NewStore(ctx, &master, isbnClient)
+	s := agorer.NewStore(ctx, master, isbnClient)
+
+	// Replaced characters are written to a report in the output dir
+	replacements := []sinli.Replacement{}
+	opts := sinli.MarshalOptions{
+		Fallback: sinli.Fallback(c.Fallback),
+		OnReplace: func(r sinli.Replacement) {
+			replacements = append(replacements, r)
+		},
+	}
 
 	stockDate := time.Now()
 	stockItems, _, err := agorer.StockItems(ctx, s)
@@ -91,7 +108,7 @@ func Run(ctx context.Context, c *Config) error {
 	}
 
 	// Marshal sinli stock
-	b, err = sinli.Marshal(stock)
+	b, err := opts.Marshal(stock)
 	if err != nil {
 		return fmt.Errorf("couldn't marshal stock: %w", err)
 	}
@@ -117,9 +134,8 @@ func Run(ctx context.Context, c *Config) error {
 		if len(details) == 0 {
 			continue
 		}
-		date, err := time.Parse("2006-01-02T15:04:05", inv.Date)
-		if err != nil {
-			return fmt.Errorf("couldn't parse date: %w", err)
+		if inv.Date.IsZero() {
+			return fmt.Errorf("missing date of invoice %d", inv.Number)
 		}
 		order := sinli.Order{
 			IdentificationHeader: sinli.IdentificationHeader{
@@ -138,13 +154,14 @@ func Run(ctx context.Context, c *Config) error {
 			Header: sinli.OrderHeader{
 				ClientName:   c.ClientName,
 				ProviderName: c.ProviderName,
-				OrderDate:    date,
+				OrderDate:    inv.Date.Time,
 				OrderCode:    strconv.Itoa(inv.Number),
 				OrderType:    sinli.OrderTypeNormal,
 				Coin:         sinli.LegacyCoinEuro,
 				Batch:        strconv.Itoa(inv.Number),
 			},
-			Details: details,
+			DeliveryPoint: agorer.OrderDeliveryPoint(deliveryPoints, &inv),
+			Details:       details,
 		}
 		subject := sinli.Subject{
 			SourceID:      c.SourceID,
@@ -154,7 +171,7 @@ func Run(ctx context.Context, c *Config) error {
 		}
 
 		// Marshal sinli order
-		b, err = sinli.Marshal(order)
+		b, err = opts.Marshal(order)
 		if err != nil {
 			return fmt.Errorf("couldn't marshal order: %w", err)
 		}
@@ -181,9 +198,8 @@ func Run(ctx context.Context, c *Config) error {
 		if len(details) == 0 {
 			continue
 		}
-		date, err := time.Parse("2006-01-02T15:04:05", inv.Date)
-		if err != nil {
-			return fmt.Errorf("couldn't parse date: %w", err)
+		if inv.Date.IsZero() {
+			return fmt.Errorf("missing date of invoice %d", inv.Number)
 		}
 		ret := sinli.Return{
 			IdentificationHeader: sinli.IdentificationHeader{
@@ -203,7 +219,7 @@ func Run(ctx context.Context, c *Config) error {
 				ClientName:   c.ClientName,
 				ProviderName: c.ProviderName,
 				OrderCode:    strconv.Itoa(inv.Number),
-				DocumentDate: date,
+				DocumentDate: inv.Date.Time,
 				DocumentType: sinli.ReturnDocumentTypeDefinitive,
 				ReturnType:   sinli.ReturnTypeDefinitive,
 				Coin:         sinli.LegacyCoinEuro,
@@ -218,7 +234,7 @@ func Run(ctx context.Context, c *Config) error {
 		}
 
 		// Marshal sinli return
-		b, err = sinli.Marshal(ret)
+		b, err = opts.Marshal(ret)
 		if err != nil {
 			return fmt.Errorf("couldn't marshal return: %w", err)
 		}
@@ -237,5 +253,50 @@ func Run(ctx context.Context, c *Config) error {
 		}
 	}
 
+	if len(replacements) > 0 {
+		b, err := json.MarshalIndent(replacements, "", "  ")
+		if err != nil {
+			return fmt.Errorf("couldn't marshal replacements: %w", err)
+		}
+		file := filepath.Join(c.OutputDir, "replacements.json")
+		if err := os.WriteFile(file, b, 0644); err != nil {
+			return fmt.Errorf("couldn't write file %s: %w", file, err)
+		}
+	}
 	return nil
 }
+
+// load returns the master and day data from the agora client, if provided,
+// or from the files.
+func load(ctx context.Context, c *Config) (*agora.Master, *agora.Day, error) {
+	if c.Agora != nil {
+		master, err := c.Agora.ExportMaster(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't get master: %w", err)
+		}
+		day, err := c.Agora.ExportDay(ctx, c.Day)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't get day: %w", err)
+		}
+		return master, day, nil
+	}
+
+	b, err := os.ReadFile(c.MasterFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't read %s: %w", c.MasterFile, err)
+	}
+	var master agora.Master
+	if err := agora.Unmarshal(b, &master, c.Location); err != nil {
+		return nil, nil, fmt.Errorf("couldn't unmarshal master: %w", err)
+	}
+
+	b, err = os.ReadFile(c.DayFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't read %s: %w", c.DayFile, err)
+	}
+	var day agora.Day
+	if err := agora.Unmarshal(b, &day, c.Location); err != nil {
+		return nil, nil, fmt.Errorf("couldn't unmarshal %s: %w", c.DayFile, err)
+	}
+	return &master, &day, nil
+}
@@ -0,0 +1,192 @@
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of units of an amount in one currency unit.
+// Amounts keep four decimals so unit prices without VAT aren't rounded
+// before being multiplied or added up.
+const Scale = 10000
+
+// rateScale is the number of units of a rate in one, rates like VAT are
+// used with four decimals.
+const rateScale = 10000
+
+// Amount is an exact decimal amount of money in ten-thousandths of the
+// currency unit.
+// Operations round half away from zero.
+type Amount int64
+
+// New returns the amount nearest to the float.
+func New(f float64) Amount {
+	return Amount(math.Round(f * Scale))
+}
+
+// FromCents returns the amount of the cents.
+func FromCents(cents int64) Amount {
+	return Amount(cents * (Scale / 100))
+}
+
+// Parse parses a decimal number like `12.34` or `-0.5`.
+// Extra decimals are rounded.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	text := s
+	var negative bool
+	switch {
+	case strings.HasPrefix(text, "-"):
+		negative = true
+		text = text[1:]
+	case strings.HasPrefix(text, "+"):
+		text = text[1:]
+	}
+	units, decimals, _ := strings.Cut(text, ".")
+	if units == "" && decimals == "" || !isDigits(units) || !isDigits(decimals) {
+		// Fallback for other formats, like exponents
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("money: invalid amount '%s'", s)
+		}
+		return New(f), nil
+	}
+	var n int64
+	if units != "" {
+		u, err := strconv.ParseInt(units, 10, 64)
+		if err != nil || u > math.MaxInt64/Scale {
+			return 0, fmt.Errorf("money: invalid amount '%s'", s)
+		}
+		n = u * Scale
+	}
+	// Keep four decimals and round with the next one
+	padded := decimals + "00000"
+	d, _ := strconv.ParseInt(padded[:4], 10, 64)
+	n += d
+	if padded[4] >= '5' {
+		n++
+	}
+	if negative {
+		n = -n
+	}
+	return Amount(n), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Float64 returns the amount as a float, to be used in approximate
+// comparisons.
+func (a Amount) Float64() float64 {
+	return float64(a) / Scale
+}
+
+// Cents returns the amount rounded to cents.
+func (a Amount) Cents() int64 {
+	return divRound(int64(a), Scale/100)
+}
+
+// Round returns the amount rounded to cents.
+func (a Amount) Round() Amount {
+	return FromCents(a.Cents())
+}
+
+// Mul returns the amount multiplied by a quantity.
+func (a Amount) Mul(n int) Amount {
+	return a * Amount(n)
+}
+
+// Div returns the amount divided by a quantity.
+func (a Amount) Div(n int) Amount {
+	if n == 0 {
+		return 0
+	}
+	return Amount(divRound(int64(a), int64(n)))
+}
+
+// MulRate returns the amount multiplied by the rate, like `1.21` to add
+// a 21% VAT.
+func (a Amount) MulRate(rate float64) Amount {
+	r := int64(math.Round(rate * rateScale))
+	return Amount(divRound(int64(a)*r, rateScale))
+}
+
+// DivRate returns the amount divided by the rate, like `1.21` to remove
+// a 21% VAT.
+func (a Amount) DivRate(rate float64) Amount {
+	r := int64(math.Round(rate * rateScale))
+	if r == 0 {
+		return 0
+	}
+	return Amount(divRound(int64(a)*rateScale, r))
+}
+
+// WithVAT returns the amount with the VAT rate added, the rate is a fraction
+// like `0.21`.
+func (a Amount) WithVAT(rate float64) Amount {
+	return a.MulRate(1 + rate)
+}
+
+// WithoutVAT returns the amount with the VAT rate removed, the rate is a
+// fraction like `0.21`.
+func (a Amount) WithoutVAT(rate float64) Amount {
+	return a.DivRate(1 + rate)
+}
+
+// String returns the amount with at least two decimals, like `12.30` or
+// `8.2645`.
+func (a Amount) String() string {
+	n := int64(a)
+	sign := ""
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+	decimals := fmt.Sprintf("%04d", n%Scale)
+	decimals = strings.TrimRight(decimals[2:], "0")
+	return fmt.Sprintf("%s%d.%02d%s", sign, n/Scale, n%Scale/100, decimals)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	v, err := Parse(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// divRound divides rounding half away from zero.
+func divRound(n, d int64) int64 {
+	if d < 0 {
+		n, d = -n, -d
+	}
+	q, r := n/d, n%d
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= d {
+		if n < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
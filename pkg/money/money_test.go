@@ -0,0 +1,101 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Amount
+		wantErr bool
+	}{
+		{input: "12.34", want: 123400},
+		{input: "-0.5", want: -5000},
+		{input: "8.264463", want: 82645},
+		{input: "-8.26445", want: -82645},
+		{input: "10", want: 100000},
+		{input: "1.5e2", want: 1500000},
+		{input: "", wantErr: true},
+		{input: "1,5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error: %s", err)
+			}
+			if got != tt.want {
+				t.Fatalf("want %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		input Amount
+		want  string
+	}{
+		{input: 123400, want: "12.34"},
+		{input: 123000, want: "12.30"},
+		{input: 82645, want: "8.2645"},
+		{input: -5, want: "-0.0005"},
+		{input: 0, want: "0.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.input.String(); got != tt.want {
+				t.Fatalf("want %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestVAT(t *testing.T) {
+	price := FromCents(2000)
+	without := price.WithoutVAT(0.21)
+	if without != 165289 {
+		t.Fatalf("want 16.5289, got %s", without)
+	}
+	if got := without.Round(); got != FromCents(1653) {
+		t.Fatalf("want 16.53, got %s", got)
+	}
+	if got := without.WithVAT(0.21).Round(); got != price {
+		t.Fatalf("want %s, got %s", price, got)
+	}
+	// Float32 rates are rounded to four decimals
+	if got := FromCents(1040).WithoutVAT(float64(float32(0.04))); got != FromCents(1000) {
+		t.Fatalf("want 10.00, got %s", got)
+	}
+	// Negative amounts are rounded away from zero
+	if got := FromCents(-1).Mul(1).Div(2).Round(); got != FromCents(-1) {
+		t.Fatalf("want -0.01, got %s", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		Price Amount `json:"price"`
+	}
+	if err := json.Unmarshal([]byte(`{"price": 20.8}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Price != FromCents(2080) {
+		t.Fatalf("want 20.80, got %s", v.Price)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"price":20.80}` {
+		t.Fatalf("want {\"price\":20.80}, got %s", b)
+	}
+}
@@ -0,0 +1,89 @@
+package sinli
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fallback is the strategy used for characters that can't be encoded to
+// CP850.
+type Fallback string
+
+const (
+	// FallbackNone fails to encode the text.
+	FallbackNone Fallback = ""
+	// FallbackTransliterate replaces the characters with their nearest
+	// CP850 or ASCII form, or '?' if there is none.
+	FallbackTransliterate Fallback = "transliterate"
+	// FallbackReplace replaces the characters with '?'.
+	FallbackReplace Fallback = "replace"
+)
+
+// Replacement describes a character replaced by the fallback.
+type Replacement struct {
+	Path  string `json:"path"`
+	Field string `json:"field"`
+	// ISBN of the record, if it has one, to identify the product
+	ISBN        string `json:"isbn,omitempty"`
+	Value       string `json:"value"`
+	Char        string `json:"char"`
+	Replacement string `json:"replacement"`
+}
+
+// Common characters outside CP850 and their nearest form
+var transliterations = map[rune]string{
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '′': "'",
+	'“': "\"", '”': "\"", '„': "\"", '‟': "\"", '″': "\"",
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '―': "-",
+	'…': "...", '•': "*", '€': "EUR", '™': "TM",
+	' ': " ", ' ': " ", ' ': " ",
+	'Œ': "OE", 'œ': "oe", 'Š': "S", 'š': "s", 'Ž': "Z", 'ž': "z", 'Ÿ': "Y",
+}
+
+func canEncode(r rune) bool {
+	_, ok := charmap.CodePage850.EncodeRune(r)
+	return ok
+}
+
+// replace applies the fallback to the characters of s that can't be encoded
+// and calls fn for each one of them.
+func replace(s string, fallback Fallback, fn func(char, replacement string)) string {
+	var b strings.Builder
+	for _, r := range s {
+		if canEncode(r) {
+			b.WriteRune(r)
+			continue
+		}
+		with := "?"
+		if fallback == FallbackTransliterate {
+			with = transliterate(r)
+		}
+		fn(string(r), with)
+		b.WriteString(with)
+	}
+	return b.String()
+}
+
+func transliterate(r rune) string {
+	if t, ok := transliterations[r]; ok {
+		return t
+	}
+	// Remove the diacritics of the decomposed character, like `ő` to `o`
+	var b strings.Builder
+	for _, d := range norm.NFD.String(string(r)) {
+		if unicode.Is(unicode.Mn, d) {
+			continue
+		}
+		if !canEncode(d) {
+			return "?"
+		}
+		b.WriteRune(d)
+	}
+	if b.Len() == 0 {
+		return "?"
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package sinli
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is a sinli record with the values of its fields formatted to be
+// read by humans.
+type Record struct {
+	// Path of the record in the document, like `Sale.Tickets[0].Details[1]`
+	Path   string        `json:"path"`
+	Type   string        `json:"type"`
+	Fields []RecordField `json:"fields"`
+}
+
+type RecordField struct {
+	Name   string `json:"name"`
+	Length int    `json:"length"`
+	Value  string `json:"value"`
+}
+
+// Inspect returns the records of v in the same order they are marshaled.
+// Fixed values and unexported fields are skipped.
+func Inspect(v interface{}) ([]Record, error) {
+	value := reflect.ValueOf(v)
+	if !value.IsValid() {
+		return nil, errors.New("sinli: value must be a struct")
+	}
+	var records []Record
+	if err := inspect(value, typeName(value.Type()), &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func inspect(value reflect.Value, path string, records *[]Record) error {
+	if isArray(value) {
+		for i := 0; i < value.Len(); i++ {
+			if err := inspect(value.Index(i), fmt.Sprintf("%s[%d]", path, i), records); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return errors.New("sinli: value must be a struct")
+	}
+	l, err := typeLayout(value.Type())
+	if err != nil {
+		return err
+	}
+	if l.hasRecord() {
+		record := Record{
+			Path: path,
+			Type: value.Type().Name(),
+		}
+		for _, f := range l.record {
+			if f.fixed != "" || !value.Type().Field(f.index).IsExported() {
+				continue
+			}
+			record.Fields = append(record.Fields, RecordField{
+				Name:   f.name,
+				Length: f.length,
+				Value:  displayString(value.Field(f.index)),
+			})
+		}
+		*records = append(*records, record)
+	}
+	for _, f := range l.nested {
+		if err := inspect(value.Field(f.index), fmt.Sprintf("%s.%s", path, f.name), records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// displayString formats the value without padding or implied decimals.
+func displayString(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			if t.IsZero() {
+				return ""
+			}
+			return t.Format("2006-01-02")
+		}
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', 2, 64)
+	case reflect.String:
+		return strings.TrimSpace(v.String())
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
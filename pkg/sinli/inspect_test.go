@@ -0,0 +1,61 @@
+package sinli
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/money"
+)
+
+func TestSinliInspect(t *testing.T) {
+	date := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	sale := Sale{
+		Header: SaleHeader{
+			ClientName:   "Client Name",
+			DispatchDate: date,
+			Coin:         CoinEuro,
+		},
+		Tickets: []SaleTicket{
+			{
+				SaleDate:   date,
+				SaleNumber: "1234",
+				NetAmount:  money.FromCents(200),
+				Details: []SaleDetail{
+					{ISBN: "9781234567890", Quantity: 1, PriceWithoutVAT: money.FromCents(101)},
+				},
+			},
+		},
+	}
+	got, err := Inspect(sale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 5 {
+		t.Fatalf("want 5 records, got %d", len(got))
+	}
+	want := []Record{
+		{
+			Path: "Sale.Tickets[0]",
+			Type: "SaleTicket",
+			Fields: []RecordField{
+				{Name: "ClientNumber", Length: 10, Value: "0"},
+				{Name: "SaleDate", Length: 8, Value: "2021-01-01"},
+				{Name: "SaleNumber", Length: 10, Value: "1234"},
+				{Name: "NetAmount", Length: 10, Value: "2.00"},
+			},
+		},
+		{
+			Path: "Sale.Tickets[0].Details[0]",
+			Type: "SaleDetail",
+			Fields: []RecordField{
+				{Name: "ISBN", Length: 17, Value: "9781234567890"},
+				{Name: "Quantity", Length: 6, Value: "1"},
+				{Name: "PriceWithoutVAT", Length: 10, Value: "1.01"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got[3:], want) {
+		t.Fatalf("want:\n%+v\ngot:\n%+v\n", want, got[3:])
+	}
+}
@@ -0,0 +1,201 @@
+package sinli
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fieldKind is how a field is written.
+type fieldKind int
+
+const (
+	// kindValue is a value of the record line
+	kindValue fieldKind = iota
+	// kindRecord is a nested record, optional if it's a pointer
+	kindRecord
+	// kindRecords is a slice or array of nested records
+	kindRecords
+)
+
+type sinliField struct {
+	index  int
+	name   string
+	order  int
+	length int
+	fixed  string
+	kind   fieldKind
+	// Offset of the value in normalized record lines
+	offset int
+}
+
+// layout is the metadata of the sinli tags of a struct type.
+type layout struct {
+	// Fields sorted by order
+	fields []sinliField
+	// Fields written in the record line
+	record []sinliField
+	// Nested records
+	nested []sinliField
+}
+
+// hasRecord returns true if the struct has fields that are written in its own
+// line, as opposed to documents that only contain nested records.
+func (l *layout) hasRecord() bool {
+	return len(l.record) > 0
+}
+
+type cachedLayout struct {
+	layout *layout
+	err    error
+}
+
+// Layouts by type, tags are parsed only once per type
+var layouts sync.Map
+
+// typeLayout returns the layout of a struct type.
+// The first time a type is used the tags of its nested records are checked
+// too, so invalid tags of types that aren't registered, like the subject, are
+// reported before anything is written.
+func typeLayout(t reflect.Type) (*layout, error) {
+	if c, ok := layouts.Load(t); ok {
+		c := c.(cachedLayout)
+		return c.layout, c.err
+	}
+	l, err := newLayout(t)
+	if err == nil {
+		err = checkNested(l, t, map[reflect.Type]struct{}{t: {}})
+	}
+	if err != nil {
+		l = nil
+	}
+	layouts.Store(t, cachedLayout{layout: l, err: err})
+	return l, err
+}
+
+func newLayout(t reflect.Type) (*layout, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, errors.New("sinli: value must be a struct")
+	}
+	fields, err := parseFields(t)
+	if err != nil {
+		return nil, err
+	}
+	l := &layout{fields: fields}
+	var offset int
+	for _, f := range fields {
+		if f.kind != kindValue {
+			l.nested = append(l.nested, f)
+			continue
+		}
+		f.offset = offset
+		offset += f.length
+		l.record = append(l.record, f)
+	}
+	return l, nil
+}
+
+// checkLayout checks the tags of a struct type and the types of its nested
+// records.
+func checkLayout(t reflect.Type) error {
+	_, err := typeLayout(t)
+	return err
+}
+
+// checkNested checks the tags of the nested records of the layout of a type,
+// skipping the types already seen so recursive records don't loop.
+func checkNested(l *layout, t reflect.Type, seen map[reflect.Type]struct{}) error {
+	for _, f := range l.nested {
+		nt := t.Field(f.index).Type
+		for nt.Kind() == reflect.Ptr || isArrayType(nt) {
+			nt = nt.Elem()
+		}
+		if _, ok := seen[nt]; ok {
+			continue
+		}
+		seen[nt] = struct{}{}
+		nl, err := newLayout(nt)
+		if err != nil {
+			return err
+		}
+		if err := checkNested(nl, nt, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFields parses the sinli tags of a struct type and returns its fields
+// sorted by order.
+func parseFields(t reflect.Type) ([]sinliField, error) {
+	var fields []sinliField
+	orders := map[int]struct{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("sinli")
+		// Split the tag into its parts
+		parts := strings.Split(tag, ",")
+
+		var order, length int
+		var fixed string
+		for _, part := range parts {
+			// Split the part into its key and value
+			kv := strings.Split(part, "=")
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("sinli: invalid tag format for %s.%s", t, field.Name)
+			}
+			k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+			switch k {
+			case "order":
+				candidate, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("sinli: invalid order '%s' for %s.%s", v, t, field.Name)
+				}
+				order = candidate
+			case "length":
+				candidate, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("sinli: invalid length '%s' for %s.%s", v, t, field.Name)
+				}
+				length = candidate
+			case "fixed":
+				fixed = v
+			default:
+				return nil, fmt.Errorf("sinli: invalid tag key '%s' for %s.%s", k, t, field.Name)
+			}
+		}
+		if order == 0 {
+			return nil, fmt.Errorf("sinli: order must be specified for %s.%s", t, field.Name)
+		}
+		kind := kindValue
+		switch {
+		case isArrayType(field.Type):
+			kind = kindRecords
+		case isSinliType(field.Type):
+			kind = kindRecord
+		}
+		if length == 0 && kind == kindValue {
+			return nil, fmt.Errorf("sinli: length must be specified for %s.%s", t, field.Name)
+		}
+		if _, ok := orders[order]; ok {
+			return nil, fmt.Errorf("sinli: duplicate order '%d' in %s", order, t)
+		}
+		orders[order] = struct{}{}
+		fields = append(fields, sinliField{
+			index:  i,
+			name:   field.Name,
+			order:  order,
+			length: length,
+			fixed:  fixed,
+			kind:   kind,
+		})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].order < fields[j].order
+	})
+	return fields, nil
+}
@@ -0,0 +1,170 @@
+package sinli
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/money"
+)
+
+func TestSinliLayout(t *testing.T) {
+	tests := []struct {
+		name  string
+		input interface{}
+		err   string
+	}{
+		{
+			name: "valid",
+			input: struct {
+				A string        `sinli:"order=1,length=2"`
+				B []StockDetail `sinli:"order=2"`
+			}{},
+		},
+		{
+			name: "duplicate order",
+			input: struct {
+				A string `sinli:"order=1,length=2"`
+				B string `sinli:"order=1,length=2"`
+			}{},
+			err: "duplicate order '1'",
+		},
+		{
+			name: "missing length",
+			input: struct {
+				A string `sinli:"order=1"`
+			}{},
+			err: "length must be specified",
+		},
+		{
+			name: "missing order",
+			input: struct {
+				A string `sinli:"length=1"`
+			}{},
+			err: "order must be specified",
+		},
+		{
+			name: "nested record",
+			input: struct {
+				A struct {
+					B string `sinli:"order=1,length=x"`
+				} `sinli:"order=1"`
+			}{},
+			err: "invalid length 'x'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLayout(reflect.TypeOf(tt.input))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("expected nil, got error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %q", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestSinliRegisterInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic, got nil")
+		}
+	}()
+	Register("TEST", 1, struct {
+		A string `sinli:"order=1"`
+	}{})
+}
+
+func TestSinliLayoutFirstUse(t *testing.T) {
+	// Types that aren't registered are checked before anything is written
+	type nested struct {
+		B string `sinli:"order=1,length=x"`
+	}
+	v := struct {
+		A string   `sinli:"order=1,length=2"`
+		N []nested `sinli:"order=2"`
+	}{A: "ok"}
+	var buf strings.Builder
+	err := NewEncoder(&buf).Encode(v)
+	if err == nil || !strings.Contains(err.Error(), "invalid length 'x'") {
+		t.Fatalf("expected invalid length error, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing written, got %q", buf.String())
+	}
+
+	// Recursive records don't loop
+	type node struct {
+		A        string `sinli:"order=1,length=2"`
+		Children []node `sinli:"order=2"`
+	}
+	if err := checkLayout(reflect.TypeOf(node{})); err != nil {
+		t.Fatalf("expected nil, got error: %s", err)
+	}
+}
+
+// benchmarkStock returns a stock with 50k detail lines.
+func benchmarkStock() Stock {
+	stock := Stock{
+		IdentificationHeader: IdentificationHeader{
+			Format:        FormatTypeNormalized,
+			Document:      FileTypeStock,
+			Version:       FileVersionStock,
+			SourceID:      "12345678",
+			DestinationID: "12345678",
+		},
+		Identification: Identification{
+			SourceEmail:      "source@fakemail.com",
+			DestinationEmail: "destination@fakemail.com",
+			FileType:         FileTypeStock,
+			FileVersion:      FileVersionStock,
+		},
+		Header: StockHeader{
+			ClientName: "Client Name",
+			StockDate:  time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			StockCoin:  CoinEuro,
+		},
+	}
+	for i := 0; i < 50000; i++ {
+		stock.Details = append(stock.Details, StockDetail{
+			ISBN:            fmt.Sprintf("978%010d", i),
+			Quantity:        i % 20,
+			PriceWithoutVAT: money.FromCents(int64(i % 5000)),
+		})
+	}
+	return stock
+}
+
+func BenchmarkSinliMarshal(b *testing.B) {
+	stock := benchmarkStock()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(stock); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSinliUnmarshal(b *testing.B) {
+	data, err := Marshal(benchmarkStock())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var stock Stock
+		if err := Unmarshal(data, &stock); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
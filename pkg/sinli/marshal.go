@@ -1,169 +1,348 @@
 package sinli
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math"
 	"reflect"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	"golang.org/x/text/encoding/charmap"
+	"github.com/igolaizola/agorer/pkg/money"
 )
 
-type sinliValue struct {
-	length int
-	value  reflect.Value
+var amountType = reflect.TypeOf(money.Amount(0))
+
+// MarshalOptions configures how values that don't fit the length of their
+// fields, or can't be encoded, are handled.
+type MarshalOptions struct {
+	// Strict returns a *StrictError if any value exceeds its field length.
+	Strict bool
+	// Truncate cuts strings that exceed their field length at rune
+	// boundaries.
+	Truncate bool
+	// Fallback for the characters of strings that can't be encoded to CP850.
+	Fallback Fallback
+	// OnReplace is called for each character replaced by the fallback.
+	OnReplace func(Replacement)
+}
+
+// FieldError describes a value that doesn't fit the length of its field or
+// is a negative number, which sinli fields can't hold.
+type FieldError struct {
+	Path     string
+	Field    string
+	Value    string
+	Length   int
+	Negative bool
+}
+
+func (e FieldError) String() string {
+	if e.Negative {
+		return fmt.Sprintf("%s.%s '%s' is negative", e.Path, e.Field, e.Value)
+	}
+	return fmt.Sprintf("%s.%s '%s' exceeds length %d", e.Path, e.Field, e.Value, e.Length)
+}
+
+// StrictError is returned in strict mode when one or more values don't fit
+// the length of their fields or are negative.
+type StrictError struct {
+	Fields []FieldError
+}
+
+func (e *StrictError) Error() string {
+	var msgs []string
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.String())
+	}
+	return fmt.Sprintf("sinli: %d values are invalid: %s", len(e.Fields), strings.Join(msgs, ", "))
 }
 
 // Marshal converts a struct into a "sinli" formatted string.
 func Marshal(v interface{}) ([]byte, error) {
-	output, err := marshal(v)
-	if err != nil {
+	return MarshalOptions{}.Marshal(v)
+}
+
+// Marshal converts a struct into a "sinli" formatted string using the
+// options.
+func (o MarshalOptions) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetOptions(o)
+	if err := enc.Encode(v); err != nil {
 		return nil, err
 	}
-	return encode(output)
+	return buf.Bytes(), nil
 }
 
-func marshal(v interface{}) (string, error) {
-	value := reflect.ValueOf(v)
+// Delimiter separates the fields of the records in free format.
+const Delimiter = "|"
+
+type encodeState struct {
+	opts MarshalOptions
+	// Format of the records, the identification header is always normalized
+	format FormatType
+	emit   func(string) error
+	// Values that exceed their field length in strict mode
+	invalid []FieldError
+}
 
-	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+// marshal converts the value into sinli records and emits them line by line.
+// In strict mode lines stop being emitted after the first invalid value, but
+// the rest of the values are still checked so all of them can be reported.
+func (e *encodeState) marshal(value reflect.Value, path string) error {
+	if isArray(value) {
 		// Loop through the slice and marshal each element
-		var output string
 		for i := 0; i < value.Len(); i++ {
-			marshaled, err := marshal(value.Index(i).Interface())
-			if err != nil {
-				return "", err
+			if err := e.marshal(value.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
 			}
-			output += string(marshaled)
 		}
-		// Append a newline to the output if it doesn't already have one
-		if !strings.HasSuffix(output, "\r\n") {
-			output += "\r\n"
-		}
-		return output, nil
+		return nil
 	}
 
-	// If the value is a pointer, dereference it
+	// If the value is a pointer, dereference it.
+	// Nil pointers are optional records that aren't written.
 	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
 		value = value.Elem()
 	}
 
 	// Ensure that the provided value is a struct
 	if value.Kind() != reflect.Struct {
-		return "", errors.New("sinli: value must be a struct")
-	}
-
-	values := map[int]sinliValue{}
-	var keys []int
-	for i := 0; i < value.NumField(); i++ {
-		field := value.Field(i)
-		tag := value.Type().Field(i).Tag.Get("sinli")
-		// Split the tag into its parts
-		parts := strings.Split(tag, ",")
-
-		var order, length int
-		var fixed string
-		for _, part := range parts {
-			// Split the part into its key and value
-			kv := strings.Split(part, "=")
-			if len(kv) != 2 {
-				return "", errors.New("sinli: invalid tag format")
+		return errors.New("sinli: value must be a struct")
+	}
+
+	l, err := typeLayout(value.Type())
+	if err != nil {
+		return err
+	}
+
+	// Write the record line before the nested records
+	if l.hasRecord() {
+		free := isFree(e.format, value.Type())
+		values := make([]string, 0, len(l.record))
+		for _, f := range l.record {
+			field := value.Field(f.index)
+			if f.fixed != "" {
+				field = reflect.ValueOf(f.fixed)
+			} else if e.opts.Fallback != FallbackNone && isString(field) {
+				field = e.replace(value, f, field, path)
 			}
-			k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
-			switch k {
-			case "order":
-				candidate, err := strconv.Atoi(v)
-				if err != nil {
-					return "", fmt.Errorf("sinli: invalid order '%s'", v)
-				}
-				order = candidate
-			case "length":
-				candidate, err := strconv.Atoi(v)
-				if err != nil {
-					return "", fmt.Errorf("sinli: invalid length '%s'", v)
+			var s string
+			if free {
+				s = toFreeString(field)
+				if strings.Contains(s, Delimiter) {
+					return fmt.Errorf("sinli: %s.%s '%s' contains delimiter '%s'", path, f.name, s, Delimiter)
 				}
-				length = candidate
-			case "fixed":
-				fixed = v
-			default:
-				return "", fmt.Errorf("sinli: invalid tag key '%s'", k)
+			} else {
+				s = toString(field, f.length)
 			}
+			tooLong := utf8.RuneCountInString(s) > f.length
+			if tooLong && e.opts.Truncate && f.fixed == "" && isString(field) {
+				s = truncate(s, f.length)
+				tooLong = false
+			}
+			if e.opts.Strict && (tooLong || isNegative(field)) {
+				e.invalid = append(e.invalid, FieldError{
+					Path:     path,
+					Field:    f.name,
+					Value:    fmt.Sprintf("%v", reflect.Indirect(field)),
+					Length:   f.length,
+					Negative: isNegative(field),
+				})
+			}
+			values = append(values, s)
 		}
-		if order == 0 {
-			return "", errors.New("sinli: order must be specified")
-		}
-		if length == 0 && !isArray(field) && !isSinli(field) {
-			return "", fmt.Errorf("sinli: length must be specified for %v", field)
+		sep := ""
+		if free {
+			sep = Delimiter
 		}
-		if _, ok := values[order]; ok {
-			return "", fmt.Errorf("sinli: duplicate order '%d'", order)
+		if len(e.invalid) == 0 {
+			if err := e.emit(strings.Join(values, sep)); err != nil {
+				return err
+			}
 		}
-		if fixed != "" {
-			field = reflect.ValueOf(fixed)
+	}
+	for _, f := range l.nested {
+		if err := e.marshal(value.Field(f.index), path+"."+f.name); err != nil {
+			return err
 		}
-		values[order] = sinliValue{
-			length: length,
-			value:  field,
+	}
+	return nil
+}
+
+// replace returns the string value with the characters that can't be
+// encoded replaced using the fallback.
+func (e *encodeState) replace(record reflect.Value, f sinliField, field reflect.Value, path string) reflect.Value {
+	text := reflect.Indirect(field).String()
+	var isbn string
+	if v := record.FieldByName("ISBN"); v.IsValid() && v.Kind() == reflect.String {
+		isbn = v.String()
+	}
+	replaced := replace(text, e.opts.Fallback, func(char, with string) {
+		if e.opts.OnReplace == nil {
+			return
 		}
-		keys = append(keys, order)
+		e.opts.OnReplace(Replacement{
+			Path:        path,
+			Field:       f.name,
+			ISBN:        isbn,
+			Value:       text,
+			Char:        char,
+			Replacement: with,
+		})
+	})
+	if replaced == text {
+		return field
 	}
-	var output string
-	sort.Ints(keys)
-	for i, key := range keys {
-		kind := values[key].value.Kind()
-		value := values[key].value
-		length := values[key].length
-		switch {
-		case kind == reflect.Slice, kind == reflect.Array, isSinli(value):
-			// Append a newline to the output if it doesn't already have one
-			// and the value isn't the first element.
-			if i > 0 && !strings.HasSuffix(output, "\r\n") {
-				output += "\r\n"
-			}
-			marshaled, err := marshal(value.Interface())
+	return reflect.ValueOf(replaced)
+}
+
+// Records returns the number of records (lines) v is marshaled into.
+func Records(v interface{}) (int, error) {
+	return countRecords(reflect.ValueOf(v))
+}
+
+func countRecords(value reflect.Value) (int, error) {
+	if isArray(value) {
+		var n int
+		for i := 0; i < value.Len(); i++ {
+			c, err := countRecords(value.Index(i))
 			if err != nil {
-				return "", err
+				return 0, err
 			}
-			output += string(marshaled)
-		default:
-			output += toString(value, length)
+			n += c
 		}
+		return n, nil
 	}
-	// Append a newline to the output if it doesn't already have one
-	if !strings.HasSuffix(output, "\r\n") {
-		output += "\r\n"
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return 0, nil
+		}
+		value = value.Elem()
 	}
-	return output, nil
+	if value.Kind() != reflect.Struct {
+		return 0, errors.New("sinli: value must be a struct")
+	}
+	l, err := typeLayout(value.Type())
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	if l.hasRecord() {
+		n++
+	}
+	for _, f := range l.nested {
+		c, err := countRecords(value.Field(f.index))
+		if err != nil {
+			return 0, err
+		}
+		n += c
+	}
+	return n, nil
 }
 
-func encode(v string) ([]byte, error) {
-	// 850 OEM – Multilingual Latin I
-	encoder := charmap.CodePage850.NewEncoder()
-	latin, err := encoder.String(v)
-	if err != nil {
-		return nil, fmt.Errorf("sinli: couldn't encode text: %w", err)
+// withRecords returns a copy of the document with the number of records set
+// in its identification header, unless it has already been set.
+func withRecords(value reflect.Value) (reflect.Value, error) {
+	doc := reflect.Indirect(value)
+	if doc.Kind() != reflect.Struct {
+		return value, nil
 	}
-	return []byte(latin), nil
+	for i := 0; i < doc.NumField(); i++ {
+		if doc.Field(i).Type() != reflect.TypeOf(IdentificationHeader{}) {
+			continue
+		}
+		if doc.Field(i).Interface().(IdentificationHeader).Records != 0 {
+			return value, nil
+		}
+		n, err := countRecords(doc)
+		if err != nil {
+			return value, err
+		}
+		cp := reflect.New(doc.Type()).Elem()
+		cp.Set(doc)
+		cp.Field(i).FieldByName("Records").SetInt(int64(n))
+		return cp, nil
+	}
+	return value, nil
+}
+
+// headerFormat returns the format of the identification header of the
+// document, if the value is or contains one.
+func headerFormat(value reflect.Value) (FormatType, bool) {
+	doc := reflect.Indirect(value)
+	if doc.Kind() != reflect.Struct {
+		return "", false
+	}
+	if h, ok := doc.Interface().(IdentificationHeader); ok {
+		return h.Format, true
+	}
+	for i := 0; i < doc.NumField(); i++ {
+		if doc.Field(i).Type() == reflect.TypeOf(IdentificationHeader{}) {
+			return doc.Field(i).Interface().(IdentificationHeader).Format, true
+		}
+	}
+	return "", false
+}
+
+// isFree returns true if the records of the type are written in free format.
+// The identification header is always normalized so the format can be read
+// before parsing the rest of the records.
+func isFree(format FormatType, t reflect.Type) bool {
+	return format == FormatTypeFree && t != reflect.TypeOf(IdentificationHeader{})
+}
+
+// typeName returns the name used as root path of error messages.
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+func isString(v reflect.Value) bool {
+	return reflect.Indirect(v).Kind() == reflect.String
+}
+
+// truncate cuts the string at rune boundaries so multi-byte characters
+// remain valid.
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length])
 }
 
 func isArray(v reflect.Value) bool {
-	return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+	return isArrayType(v.Type())
 }
 
-func isSinli(v reflect.Value) bool {
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
+func isArrayType(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+}
+
+// isSinliType returns true if the type is a struct, or a pointer to a struct,
+// whose fields have sinli tags.
+func isSinliType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
-	if v.Kind() != reflect.Struct {
+	if t.Kind() != reflect.Struct {
 		return false
 	}
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Type().Field(i)
-		tag := field.Tag.Get("sinli")
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("sinli")
 		if tag != "" {
 			return true
 		}
@@ -180,6 +359,10 @@ func toString(v reflect.Value, length int) string {
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
+	// Amounts are written in cents, with two implied decimals
+	if v.Type() == amountType {
+		return fmt.Sprintf("%0"+strconv.Itoa(length)+"d", money.Amount(v.Int()).Cents())
+	}
 	switch v.Kind() {
 	case reflect.Bool:
 		if v.Bool() {
@@ -204,6 +387,49 @@ func toString(v reflect.Value, length int) string {
 	return fmt.Sprintf("%-"+strconv.Itoa(length)+"s", s)
 }
 
+// isNegative returns true if the value is a negative number, amounts
+// included.
+func isNegative(v reflect.Value) bool {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return roundFloat(v.Float(), 2) < 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() < 0
+	}
+	return false
+}
+
+// toFreeString returns the value without padding, as written in free format.
+func toFreeString(v reflect.Value) string {
+	// If the value is a pointer and it's nil, return an empty string
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return ""
+	}
+	// Obtain the underlying value
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Type() == amountType {
+		return strconv.FormatInt(money.Amount(v.Int()).Cents(), 10)
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		// Keep two implied decimals as in normalized format
+		return strconv.FormatInt(int64(math.Round(v.Float()*100)), 10)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.String:
+		return strings.TrimRight(v.String(), " ")
+	}
+	return toString(v, 0)
+}
+
 func roundFloat(number float64, decimals int) float64 {
 	shift := math.Pow(10, float64(decimals))
 	rounded := math.Round(number*shift) / shift
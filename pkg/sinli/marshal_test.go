@@ -2,8 +2,12 @@ package sinli
 
 import (
 	"bytes"
+	"errors"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/igolaizola/agorer/pkg/money"
 )
 
 // Example usage
@@ -20,6 +24,12 @@ type Foo struct {
 	Body   []Bar `sinli:"order=2"`
 }
 
+type Baz struct {
+	Header   Bar   `sinli:"order=1"`
+	Optional *Bar  `sinli:"order=2"`
+	Body     []Bar `sinli:"order=3"`
+}
+
 func TestSinliMarshal(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -109,6 +119,32 @@ func TestSinliMarshal(t *testing.T) {
 			},
 			want: []byte("BHeader    0000100001S\r\nBHello     0004201234S\r\nBWorld     -0043-1235N\r\n"),
 		},
+		{
+			name: "amount",
+			input: StockDetail{
+				ISBN:            "9781234567890",
+				Quantity:        1,
+				PriceWithoutVAT: money.New(16.5289),
+			},
+			want: []byte("D9781234567890    0000010000001653\r\n"),
+		},
+		{
+			name: "optional nil",
+			input: Baz{
+				Header: Bar{Text: "Header"},
+				Body:   []Bar{{Text: "Hello"}},
+			},
+			want: []byte("BHeader    0000000000N\r\nBHello     0000000000N\r\n"),
+		},
+		{
+			name: "optional set",
+			input: Baz{
+				Header:   Bar{Text: "Header"},
+				Optional: &Bar{Text: "Optional"},
+				Body:     []Bar{{Text: "Hello"}},
+			},
+			want: []byte("BHeader    0000000000N\r\nBOptional  0000000000N\r\nBHello     0000000000N\r\n"),
+		},
 		{
 			name: "stock",
 			input: Stock{
@@ -134,22 +170,63 @@ func TestSinliMarshal(t *testing.T) {
 					{
 						ISBN:            "9781234567890",
 						Quantity:        1,
-						PriceWithoutVAT: 1.01,
+						PriceWithoutVAT: money.FromCents(101),
 					},
 					{
 						ISBN:            "9781234567891",
 						Quantity:        1,
-						PriceWithoutVAT: 0.99,
+						PriceWithoutVAT: money.FromCents(99),
 					},
 				},
 			},
-			want: []byte("INCEGALD021234567812345678000000000000                                     FANDE\r\n" +
+			want: []byte("INCEGALD021234567812345678000050000000                                     FANDE\r\n" +
 				"Isource@fakemail.com                               destination@fakemail.com                          CEGALD0200000000\r\n" +
 				"CClient Name                             20210101EUR\r\n" +
 				"D9781234567890    0000010000000101\r\n" +
 				"D9781234567891    0000010000000099\r\n",
 			),
 		},
+		{
+			name: "stock free format",
+			input: Stock{
+				IdentificationHeader: IdentificationHeader{
+					Format:        FormatTypeFree,
+					Document:      FileTypeStock,
+					Version:       FileVersionStock,
+					SourceID:      "12345678",
+					DestinationID: "12345678",
+				},
+				Identification: Identification{
+					SourceEmail:      "source@fakemail.com",
+					DestinationEmail: "destination@fakemail.com",
+					FileType:         FileTypeStock,
+					FileVersion:      FileVersionStock,
+				},
+				Header: StockHeader{
+					ClientName: "Client Name",
+					StockDate:  time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					StockCoin:  CoinEuro,
+				},
+				Details: []StockDetail{
+					{
+						ISBN:            "9781234567890",
+						Quantity:        1,
+						PriceWithoutVAT: money.FromCents(101),
+					},
+					{
+						ISBN:            "9781234567891",
+						Quantity:        1,
+						PriceWithoutVAT: money.FromCents(99),
+					},
+				},
+			},
+			want: []byte("ILCEGALD021234567812345678000050000000                                     FANDE\r\n" +
+				"I|source@fakemail.com|destination@fakemail.com|CEGALD|2|0\r\n" +
+				"C|Client Name|20210101|EUR\r\n" +
+				"D|9781234567890|1|101\r\n" +
+				"D|9781234567891|1|99\r\n",
+			),
+		},
 		{
 			name: "sale",
 			input: Sale{
@@ -176,17 +253,17 @@ func TestSinliMarshal(t *testing.T) {
 						ClientNumber: 777,
 						SaleDate:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 						SaleNumber:   "1234",
-						NetAmount:    2.0,
+						NetAmount:    money.FromCents(200),
 						Details: []SaleDetail{
 							{
 								ISBN:            "9781234567890",
 								Quantity:        1,
-								PriceWithoutVAT: 1.01,
+								PriceWithoutVAT: money.FromCents(101),
 							},
 							{
 								ISBN:            "9781234567891",
 								Quantity:        1,
-								PriceWithoutVAT: 0.99,
+								PriceWithoutVAT: money.FromCents(99),
 							},
 						},
 					},
@@ -194,23 +271,23 @@ func TestSinliMarshal(t *testing.T) {
 						ClientNumber: 777,
 						SaleDate:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 						SaleNumber:   "1234",
-						NetAmount:    2.0,
+						NetAmount:    money.FromCents(200),
 						Details: []SaleDetail{
 							{
 								ISBN:            "9781234567890",
 								Quantity:        1,
-								PriceWithoutVAT: 1.01,
+								PriceWithoutVAT: money.FromCents(101),
 							},
 							{
 								ISBN:            "9781234567891",
 								Quantity:        1,
-								PriceWithoutVAT: 0.99,
+								PriceWithoutVAT: money.FromCents(99),
 							},
 						},
 					},
 				},
 			},
-			want: []byte("INCEGALV031234567812345678000000000000                                     FANDE\r\n" +
+			want: []byte("INCEGALV031234567812345678000090000000                                     FANDE\r\n" +
 				"Isource@fakemail.com                               destination@fakemail.com                          CEGALV0300000000\r\n" +
 				"CClient Name                             20210101EUR\r\n" +
 				"T0000000777202101011234      0000000200\r\n" +
@@ -239,3 +316,140 @@ func TestSinliMarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestSinliMarshalOptions(t *testing.T) {
+	foo := Foo{
+		Header: Bar{
+			Text:    "Ñandú header",
+			Number:  1,
+			Decimal: 0.01,
+		},
+		Body: []Bar{
+			{
+				Text:    "Hello",
+				Number:  123456,
+				Decimal: 12.34,
+			},
+		},
+	}
+
+	// Default mode doesn't check lengths
+	if _, err := Marshal(foo); err != nil {
+		t.Fatalf("expected nil, got error: %s", err)
+	}
+
+	// Strict mode reports every invalid value
+	_, err := MarshalOptions{Strict: true}.Marshal(foo)
+	var strictErr *StrictError
+	if !errors.As(err, &strictErr) {
+		t.Fatalf("expected strict error, got %v", err)
+	}
+	want := []FieldError{
+		{Path: "Foo.Header", Field: "Text", Value: "Ñandú header", Length: 10},
+		{Path: "Foo.Body[0]", Field: "Number", Value: "123456", Length: 5},
+	}
+	if !reflect.DeepEqual(strictErr.Fields, want) {
+		t.Fatalf("want:\n%+v\ngot:\n%+v\n", want, strictErr.Fields)
+	}
+
+	// Truncate mode cuts strings but numbers are still reported
+	_, err = MarshalOptions{Strict: true, Truncate: true}.Marshal(foo)
+	if !errors.As(err, &strictErr) {
+		t.Fatalf("expected strict error, got %v", err)
+	}
+	if !reflect.DeepEqual(strictErr.Fields, want[1:]) {
+		t.Fatalf("want:\n%+v\ngot:\n%+v\n", want[1:], strictErr.Fields)
+	}
+
+	// Truncated multi-byte text is still valid
+	foo.Body[0].Number = 42
+	got, err := MarshalOptions{Strict: true, Truncate: true}.Marshal(foo)
+	if err != nil {
+		t.Fatalf("expected nil, got error: %s", err)
+	}
+	var decoded Foo
+	if err := Unmarshal(got, &decoded); err != nil {
+		t.Fatalf("couldn't unmarshal: %s", err)
+	}
+	if decoded.Header.Text != "Ñandú head" {
+		t.Fatalf("want 'Ñandú head', got '%s'", decoded.Header.Text)
+	}
+
+	// Negative numbers are reported even if they fit
+	neg := Bar{Number: -5, Decimal: -1.5}
+	if _, err := Marshal(neg); err != nil {
+		t.Fatalf("expected nil, got error: %s", err)
+	}
+	_, err = MarshalOptions{Strict: true}.Marshal(neg)
+	if !errors.As(err, &strictErr) {
+		t.Fatalf("expected strict error, got %v", err)
+	}
+	want = []FieldError{
+		{Path: "Bar", Field: "Number", Value: "-5", Length: 5, Negative: true},
+		{Path: "Bar", Field: "Decimal", Value: "-1.5", Length: 5, Negative: true},
+	}
+	if !reflect.DeepEqual(strictErr.Fields, want) {
+		t.Fatalf("want:\n%+v\ngot:\n%+v\n", want, strictErr.Fields)
+	}
+	for _, v := range []interface{}{
+		Bar{Number: -9999},
+		Bar{Decimal: -999.99},
+		StockDetail{ISBN: "9781779511195", Quantity: 1, PriceWithoutVAT: money.New(-1.5)},
+	} {
+		if _, err := (MarshalOptions{Strict: true}).Marshal(v); !errors.As(err, &strictErr) {
+			t.Fatalf("%+v: expected strict error, got %v", v, err)
+		}
+	}
+}
+
+func TestSinliMarshalFallback(t *testing.T) {
+	bar := Bar{Text: "“Ő€”漢"}
+
+	// Default mode fails to encode the text
+	if _, err := Marshal(bar); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	tests := []struct {
+		name     string
+		fallback Fallback
+		want     []byte
+		replaced []string
+	}{
+		{
+			name:     "transliterate",
+			fallback: FallbackTransliterate,
+			want:     []byte("B\"OEUR\"?   0000000000N\r\n"),
+			replaced: []string{"“\"", "ŐO", "€EUR", "”\"", "漢?"},
+		},
+		{
+			name:     "replace",
+			fallback: FallbackReplace,
+			want:     []byte("B?????     0000000000N\r\n"),
+			replaced: []string{"“?", "Ő?", "€?", "”?", "漢?"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var replaced []string
+			got, err := MarshalOptions{
+				Fallback: tt.fallback,
+				OnReplace: func(r Replacement) {
+					if r.Path != "Bar" || r.Field != "Text" || r.Value != bar.Text {
+						t.Errorf("unexpected replacement %+v", r)
+					}
+					replaced = append(replaced, r.Char+r.Replacement)
+				},
+			}.Marshal(bar)
+			if err != nil {
+				t.Fatalf("expected nil, got error: %s", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("want:\n'%s'\ngot:\n'%s'\n", tt.want, got)
+			}
+			if !reflect.DeepEqual(replaced, tt.replaced) {
+				t.Fatalf("want %v, got %v", tt.replaced, replaced)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package sinli
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var (
+	registry    = map[FileType]map[FileVersion]reflect.Type{}
+	registryLck sync.RWMutex
+)
+
+func init() {
+	Register(FileTypeStock, FileVersionStock, Stock{})
+	Register(FileTypeOrder, FileVersionOrder, Order{})
+	Register(FileTypeReturn, FileVersionReturn, Return{})
+	Register(FileTypeSale, FileVersionSale, Sale{})
+	Register(FileTypeSale, FileVersionSaleV2, SaleV2{})
+	Register(FileTypeDelivery, FileVersionDelivery, Delivery{})
+	Register(FileTypeInvoice, FileVersionInvoice, Invoice{})
+	Register(FileTypeCatalog, FileVersionCatalog, Catalog{})
+}
+
+// Register registers the Go type used as layout for a document type and
+// version.
+// It panics if the layout is already registered or its tags are invalid, so
+// layout errors are found at init instead of when a document is sent.
+func Register(fileType FileType, version FileVersion, v interface{}) {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if err := checkLayout(t); err != nil {
+		panic(err)
+	}
+	registryLck.Lock()
+	defer registryLck.Unlock()
+	if registry[fileType] == nil {
+		registry[fileType] = map[FileVersion]reflect.Type{}
+	}
+	if _, ok := registry[fileType][version]; ok {
+		panic(fmt.Sprintf("sinli: layout %s version %d already registered", fileType, version))
+	}
+	registry[fileType][version] = t
+}
+
+// New returns a pointer to a new document of the layout registered for the
+// document type and version.
+func New(fileType FileType, version FileVersion) (interface{}, error) {
+	registryLck.RLock()
+	defer registryLck.RUnlock()
+	t, ok := registry[fileType][version]
+	if !ok {
+		return nil, fmt.Errorf("sinli: unsupported document %s version %d", fileType, version)
+	}
+	return reflect.New(t).Interface(), nil
+}
+
+// Versions returns the registered versions of a document type.
+func Versions(fileType FileType) []FileVersion {
+	registryLck.RLock()
+	defer registryLck.RUnlock()
+	var versions []FileVersion
+	for v := range registry[fileType] {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+	return versions
+}
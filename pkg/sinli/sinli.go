@@ -1,6 +1,10 @@
 package sinli
 
-import "time"
+import (
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/money"
+)
 
 // Subject to be used in the email where the sinli file is attached.
 // Example: `ESFANDELXXXXXXXESFANDELXXXXXXXLIBROSNNFANDE`
@@ -14,7 +18,7 @@ type Subject struct {
 	FileType          FileType    `sinli:"order=5,length=6"`
 	FileVersion       FileVersion `sinli:"order=6,length=2"`
 	//lint:ignore U1000 Fixed value
-	suffix string `sinli:"order=7,length=5,fixed=ESFANDE"`
+	suffix string `sinli:"order=7,length=5,fixed=FANDE"`
 }
 
 // IdentificationHeader is the first line of a sinli file.
@@ -58,19 +62,26 @@ type Identification struct {
 type FileVersion int
 
 const (
-	FileVersionStock  FileVersion = 2
-	FileVersionOrder  FileVersion = 7
-	FileVersionReturn FileVersion = 2
-	FileVersionSale   FileVersion = 3
+	FileVersionStock    FileVersion = 2
+	FileVersionOrder    FileVersion = 7
+	FileVersionReturn   FileVersion = 2
+	FileVersionSale     FileVersion = 3
+	FileVersionSaleV2   FileVersion = 2
+	FileVersionDelivery FileVersion = 8
+	FileVersionInvoice  FileVersion = 2
+	FileVersionCatalog  FileVersion = 9
 )
 
 type FileType string
 
 const (
-	FileTypeStock  FileType = "CEGALD"
-	FileTypeOrder  FileType = "PEDIDO"
-	FileTypeReturn FileType = "DEVOLU"
-	FileTypeSale   FileType = "CEGALV"
+	FileTypeStock    FileType = "CEGALD"
+	FileTypeOrder    FileType = "PEDIDO"
+	FileTypeReturn   FileType = "DEVOLU"
+	FileTypeSale     FileType = "CEGALV"
+	FileTypeDelivery FileType = "ENVIO"
+	FileTypeInvoice  FileType = "FACTUL"
+	FileTypeCatalog  FileType = "LIBROS"
 )
 
 // Order is a sinli order. Code: `PEDIDO`
@@ -78,7 +89,9 @@ type Order struct {
 	IdentificationHeader IdentificationHeader `sinli:"order=1"`
 	Identification       Identification       `sinli:"order=2"`
 	Header               OrderHeader          `sinli:"order=3"`
-	Details              []OrderDetail        `sinli:"order=4"`
+	// Optional, leave nil to use the client default address
+	DeliveryPoint *OrderDeliveryPoint `sinli:"order=4"`
+	Details       []OrderDetail       `sinli:"order=5"`
 }
 
 type OrderHeader struct {
@@ -125,17 +138,17 @@ type OrderDeliveryPoint struct {
 }
 
 type OrderDetail struct {
-	_            struct{}    `sinli:"order=1,length=1,fixed=D"`
-	ISBN         string      `sinli:"order=2,length=17"`
-	EAN          string      `sinli:"order=3,length=18"`
-	Reference    string      `sinli:"order=4,length=15"`
-	Title        string      `sinli:"order=5,length=50"`
-	Quantity     int         `sinli:"order=6,length=6"`
-	PriceWithVAT float32     `sinli:"order=7,length=10"`
-	WantPending  bool        `sinli:"order=8,length=1"`
-	OrderSource  OrderSource `sinli:"order=9,length=1"`
-	FastDelivery bool        `sinli:"order=10,length=1"`
-	Code         string      `sinli:"order=11,length=10"`
+	_            struct{}     `sinli:"order=1,length=1,fixed=D"`
+	ISBN         string       `sinli:"order=2,length=17"`
+	EAN          string       `sinli:"order=3,length=18"`
+	Reference    string       `sinli:"order=4,length=15"`
+	Title        string       `sinli:"order=5,length=50"`
+	Quantity     int          `sinli:"order=6,length=6"`
+	PriceWithVAT money.Amount `sinli:"order=7,length=10"`
+	WantPending  bool         `sinli:"order=8,length=1"`
+	OrderSource  OrderSource  `sinli:"order=9,length=1"`
+	FastDelivery bool         `sinli:"order=10,length=1"`
+	Code         string       `sinli:"order=11,length=10"`
 }
 
 type OrderSource string
@@ -180,16 +193,16 @@ const (
 )
 
 type ReturnDetail struct {
-	_               struct{}  `sinli:"order=1,length=1,fixed=D"`
-	ISBN            string    `sinli:"order=2,length=17"`
-	EAN             string    `sinli:"order=3,length=18"`
-	Reference       string    `sinli:"order=4,length=15"`
-	Title           string    `sinli:"order=5,length=50"`
-	Quantity        int       `sinli:"order=6,length=6"`
-	PriceWithoutVAT float32   `sinli:"order=7,length=10"`
-	PriceWithVAT    float32   `sinli:"order=8,length=10"`
-	Discount        float32   `sinli:"order=9,length=10"`
-	PriceType       PriceType `sinli:"order=10,length=1"`
+	_               struct{}     `sinli:"order=1,length=1,fixed=D"`
+	ISBN            string       `sinli:"order=2,length=17"`
+	EAN             string       `sinli:"order=3,length=18"`
+	Reference       string       `sinli:"order=4,length=15"`
+	Title           string       `sinli:"order=5,length=50"`
+	Quantity        int          `sinli:"order=6,length=6"`
+	PriceWithoutVAT money.Amount `sinli:"order=7,length=10"`
+	PriceWithVAT    money.Amount `sinli:"order=8,length=10"`
+	Discount        float32      `sinli:"order=9,length=10"`
+	PriceType       PriceType    `sinli:"order=10,length=1"`
 
 	// Optionals
 	Novelty          bool         `sinli:"order=11,length=1"`
@@ -236,10 +249,10 @@ const (
 )
 
 type StockDetail struct {
-	_               struct{} `sinli:"order=1,length=1,fixed=D"`
-	ISBN            string   `sinli:"order=2,length=17"`
-	Quantity        int      `sinli:"order=3,length=6"`
-	PriceWithoutVAT float32  `sinli:"order=4,length=10"`
+	_               struct{}     `sinli:"order=1,length=1,fixed=D"`
+	ISBN            string       `sinli:"order=2,length=17"`
+	Quantity        int          `sinli:"order=3,length=6"`
+	PriceWithoutVAT money.Amount `sinli:"order=4,length=10"`
 }
 
 // Sale is a sinli sale. Code: `CEGALV`
@@ -263,13 +276,188 @@ type SaleTicket struct {
 	ClientNumber int          `sinli:"order=2,length=10"`
 	SaleDate     time.Time    `sinli:"order=3,length=8"`
 	SaleNumber   string       `sinli:"order=4,length=10"`
-	NetAmount    float32      `sinli:"order=5,length=10"`
+	NetAmount    money.Amount `sinli:"order=5,length=10"`
 	Details      []SaleDetail `sinli:"order=6"`
 }
 
 type SaleDetail struct {
-	_               struct{} `sinli:"order=1,length=1,fixed=D"`
-	ISBN            string   `sinli:"order=2,length=17"`
-	Quantity        int      `sinli:"order=3,length=6"`
-	PriceWithoutVAT float32  `sinli:"order=4,length=10"`
+	_               struct{}     `sinli:"order=1,length=1,fixed=D"`
+	ISBN            string       `sinli:"order=2,length=17"`
+	Quantity        int          `sinli:"order=3,length=6"`
+	PriceWithoutVAT money.Amount `sinli:"order=4,length=10"`
+}
+
+// SaleV2 is a sinli sale using the older version 2 layout. Code: `CEGALV`
+// It has no ticket records, each detail has its own sale date.
+type SaleV2 struct {
+	IdentificationHeader IdentificationHeader `sinli:"order=1"`
+	Identification       Identification       `sinli:"order=2"`
+	Header               SaleHeader           `sinli:"order=3"`
+	Details              []SaleDetailV2       `sinli:"order=4"`
+}
+
+type SaleDetailV2 struct {
+	_               struct{}     `sinli:"order=1,length=1,fixed=D"`
+	SaleDate        time.Time    `sinli:"order=2,length=8"`
+	ISBN            string       `sinli:"order=3,length=17"`
+	Quantity        int          `sinli:"order=4,length=6"`
+	PriceWithoutVAT money.Amount `sinli:"order=5,length=10"`
+}
+
+// Delivery is a sinli delivery note. Code: `ENVIO`
+type Delivery struct {
+	IdentificationHeader IdentificationHeader `sinli:"order=1"`
+	Identification       Identification       `sinli:"order=2"`
+	Header               DeliveryHeader       `sinli:"order=3"`
+	Details              []DeliveryDetail     `sinli:"order=4"`
+	Totals               DeliveryTotals       `sinli:"order=5"`
+}
+
+type DeliveryHeader struct {
+	_              struct{}     `sinli:"order=1,length=1,fixed=C"`
+	ClientName     string       `sinli:"order=2,length=40"`
+	ProviderName   string       `sinli:"order=3,length=40"`
+	DeliveryNumber string       `sinli:"order=4,length=10"`
+	DeliveryDate   time.Time    `sinli:"order=5,length=8"`
+	DeliveryType   DeliveryType `sinli:"order=6,length=1"`
+	Coin           LegacyCoin   `sinli:"order=7,length=1"`
+
+	// Optionals
+	BookFair bool `sinli:"order=8,length=1"`
+}
+
+type DeliveryType string
+
+const (
+	DeliveryTypeDefinitive DeliveryType = "F"
+	DeliveryTypeDeposit    DeliveryType = "D"
+)
+
+type DeliveryDetail struct {
+	_               struct{}     `sinli:"order=1,length=1,fixed=D"`
+	ISBN            string       `sinli:"order=2,length=17"`
+	EAN             string       `sinli:"order=3,length=18"`
+	Reference       string       `sinli:"order=4,length=15"`
+	Title           string       `sinli:"order=5,length=50"`
+	Quantity        int          `sinli:"order=6,length=6"`
+	PriceWithoutVAT money.Amount `sinli:"order=7,length=10"`
+	PriceWithVAT    money.Amount `sinli:"order=8,length=10"`
+	Discount        float32      `sinli:"order=9,length=6"`
+	PriceType       PriceType    `sinli:"order=10,length=1"`
+
+	// Optionals
+	Novelty   bool    `sinli:"order=11,length=1"`
+	OrderCode string  `sinli:"order=12,length=10"`
+	VATRate   float32 `sinli:"order=13,length=5"`
 }
+
+type DeliveryTotals struct {
+	_                struct{}     `sinli:"order=1,length=1,fixed=T"`
+	Units            int          `sinli:"order=2,length=8"`
+	GrossAmount      money.Amount `sinli:"order=3,length=10"`
+	AmountWithoutVAT money.Amount `sinli:"order=4,length=10"`
+	AmountWithVAT    money.Amount `sinli:"order=5,length=10"`
+}
+
+// Invoice is a sinli invoice. Code: `FACTUL`
+type Invoice struct {
+	IdentificationHeader IdentificationHeader `sinli:"order=1"`
+	Identification       Identification       `sinli:"order=2"`
+	Header               InvoiceHeader        `sinli:"order=3"`
+	Details              []InvoiceDetail      `sinli:"order=4"`
+	Taxes                []InvoiceTax         `sinli:"order=5"`
+	Totals               InvoiceTotals        `sinli:"order=6"`
+}
+
+type InvoiceHeader struct {
+	_             struct{}   `sinli:"order=1,length=1,fixed=C"`
+	ClientName    string     `sinli:"order=2,length=40"`
+	ProviderName  string     `sinli:"order=3,length=40"`
+	InvoiceNumber string     `sinli:"order=4,length=10"`
+	InvoiceDate   time.Time  `sinli:"order=5,length=8"`
+	Coin          LegacyCoin `sinli:"order=6,length=1"`
+
+	// Optionals
+	DueDate *time.Time `sinli:"order=7,length=8"`
+}
+
+type InvoiceDetail struct {
+	_               struct{}     `sinli:"order=1,length=1,fixed=D"`
+	DeliveryNumber  string       `sinli:"order=2,length=10"`
+	ISBN            string       `sinli:"order=3,length=17"`
+	EAN             string       `sinli:"order=4,length=18"`
+	Reference       string       `sinli:"order=5,length=15"`
+	Title           string       `sinli:"order=6,length=50"`
+	Quantity        int          `sinli:"order=7,length=6"`
+	PriceWithoutVAT money.Amount `sinli:"order=8,length=10"`
+	PriceWithVAT    money.Amount `sinli:"order=9,length=10"`
+	Discount        float32      `sinli:"order=10,length=6"`
+	PriceType       PriceType    `sinli:"order=11,length=1"`
+	// Amount of the line without VAT after applying the discount
+	NetAmount money.Amount `sinli:"order=12,length=10"`
+	VATRate   float32      `sinli:"order=13,length=5"`
+}
+
+// InvoiceTax is the VAT breakdown of the invoice for each rate.
+type InvoiceTax struct {
+	_               struct{}     `sinli:"order=1,length=1,fixed=V"`
+	VATRate         float32      `sinli:"order=2,length=5"`
+	TaxableBase     money.Amount `sinli:"order=3,length=10"`
+	VATAmount       money.Amount `sinli:"order=4,length=10"`
+	SurchargeRate   float32      `sinli:"order=5,length=5"`
+	SurchargeAmount money.Amount `sinli:"order=6,length=10"`
+}
+
+type InvoiceTotals struct {
+	_                struct{}     `sinli:"order=1,length=1,fixed=T"`
+	Units            int          `sinli:"order=2,length=8"`
+	GrossAmount      money.Amount `sinli:"order=3,length=10"`
+	AmountWithoutVAT money.Amount `sinli:"order=4,length=10"`
+	VATAmount        money.Amount `sinli:"order=5,length=10"`
+	AmountWithVAT    money.Amount `sinli:"order=6,length=10"`
+}
+
+// Catalog is a sinli bibliographic catalog. Code: `LIBROS`
+type Catalog struct {
+	IdentificationHeader IdentificationHeader `sinli:"order=1"`
+	Identification       Identification       `sinli:"order=2"`
+	Header               CatalogHeader        `sinli:"order=3"`
+	Books                []CatalogBook        `sinli:"order=4"`
+}
+
+type CatalogHeader struct {
+	_            struct{}  `sinli:"order=1,length=1,fixed=C"`
+	ProviderName string    `sinli:"order=2,length=40"`
+	CatalogDate  time.Time `sinli:"order=3,length=8"`
+	Coin         Coin      `sinli:"order=4,length=3"`
+}
+
+type CatalogBook struct {
+	_               struct{}     `sinli:"order=1,length=1,fixed=D"`
+	ISBN            string       `sinli:"order=2,length=17"`
+	EAN             string       `sinli:"order=3,length=18"`
+	Reference       string       `sinli:"order=4,length=15"`
+	Title           string       `sinli:"order=5,length=80"`
+	Subtitle        string       `sinli:"order=6,length=80"`
+	Author          string       `sinli:"order=7,length=150"`
+	Publisher       string       `sinli:"order=8,length=40"`
+	PublicationDate *time.Time   `sinli:"order=9,length=8"`
+	Pages           int          `sinli:"order=10,length=5"`
+	PriceWithoutVAT money.Amount `sinli:"order=11,length=10"`
+	PriceWithVAT    money.Amount `sinli:"order=12,length=10"`
+	VATRate         float32      `sinli:"order=13,length=5"`
+	PriceType       PriceType    `sinli:"order=14,length=1"`
+	Status          BookStatus   `sinli:"order=15,length=1"`
+	// Language as in ISO 639-2
+	Language string `sinli:"order=16,length=3"`
+}
+
+type BookStatus string
+
+const (
+	BookStatusAvailable    BookStatus = "D"
+	BookStatusOutOfPrint   BookStatus = "A"
+	BookStatusForthcoming  BookStatus = "P"
+	BookStatusReprinting   BookStatus = "R"
+	BookStatusOutOfCatalog BookStatus = "B"
+)
@@ -0,0 +1,174 @@
+package sinli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Encoder writes sinli records to an output stream.
+type Encoder struct {
+	w       io.Writer
+	encoder *encoding.Encoder
+	opts    MarshalOptions
+	// Format of the last identification header written
+	format FormatType
+}
+
+// NewEncoder returns a new encoder that writes to w.
+// Records are encoded to CP850 as they are written.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w: w,
+		// 850 OEM – Multilingual Latin I
+		encoder: charmap.CodePage850.NewEncoder(),
+	}
+}
+
+// Encode writes the sinli records of v to the stream.
+// It can be called with a whole document or with single records, so the
+// header records can be written first and the details streamed one by one.
+// If the document identification header has no records count, it is set to
+// the number of lines of the document. When details are streamed, the count
+// must be set by the caller.
+// Records are written in the format of the last identification header
+// encoded, so details streamed after the header use the same format.
+func (e *Encoder) Encode(v interface{}) error {
+	value := reflect.ValueOf(v)
+	if !value.IsValid() {
+		return errors.New("sinli: value must be a struct")
+	}
+	value, err := withRecords(value)
+	if err != nil {
+		return err
+	}
+	if format, ok := headerFormat(value); ok {
+		e.format = format
+	}
+	state := &encodeState{
+		opts:   e.opts,
+		format: e.format,
+		emit:   e.writeLine,
+	}
+	if err := state.marshal(value, typeName(value.Type())); err != nil {
+		return err
+	}
+	if len(state.invalid) > 0 {
+		return &StrictError{Fields: state.invalid}
+	}
+	return nil
+}
+
+// SetOptions sets the options used to marshal the values.
+func (e *Encoder) SetOptions(opts MarshalOptions) {
+	e.opts = opts
+}
+
+func (e *Encoder) writeLine(line string) error {
+	latin, err := e.encoder.String(line)
+	if err != nil {
+		return fmt.Errorf("sinli: couldn't encode text: %w", err)
+	}
+	if _, err := io.WriteString(e.w, latin+"\r\n"); err != nil {
+		return fmt.Errorf("sinli: couldn't write: %w", err)
+	}
+	return nil
+}
+
+// Decoder reads sinli records from an input stream.
+type Decoder struct {
+	scanner *bufio.Scanner
+	decoder *encoding.Decoder
+	// Next line to be consumed, if peeked
+	buffer string
+	peeked bool
+	// Number of lines consumed
+	line int
+	// Format of the last identification header read
+	format FormatType
+	err    error
+}
+
+// NewDecoder returns a new decoder that reads from r.
+// Records are decoded from CP850 as they are read.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		scanner: bufio.NewScanner(r),
+		// 850 OEM – Multilingual Latin I
+		decoder: charmap.CodePage850.NewDecoder(),
+	}
+}
+
+// Decode reads the next sinli records from the stream and stores them in the
+// value pointed to by v.
+// If v is a single record, only one line is read.
+// If v points to an interface, the document layout is picked from the
+// registered layouts using the type and version of the identification header.
+func (d *Decoder) Decode(v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return errors.New("sinli: value must be a non-nil pointer")
+	}
+	var err error
+	if value.Elem().Kind() == reflect.Interface {
+		// Pick the layout from the identification header
+		err = d.unmarshalDocument(value.Elem())
+	} else {
+		err = d.unmarshal(value.Elem())
+	}
+	if d.err != nil {
+		return d.err
+	}
+	return err
+}
+
+// More reports whether there are more records in the stream.
+func (d *Decoder) More() bool {
+	_, ok := d.peek()
+	return ok
+}
+
+// peek returns the next non empty line without consuming it.
+func (d *Decoder) peek() (string, bool) {
+	if d.peeked {
+		return d.buffer, true
+	}
+	if d.err != nil {
+		return "", false
+	}
+	for d.scanner.Scan() {
+		line := strings.TrimSuffix(d.scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			d.line++
+			continue
+		}
+		text, err := d.decoder.String(line)
+		if err != nil {
+			d.err = fmt.Errorf("sinli: line %d: couldn't decode text: %w", d.line+1, err)
+			return "", false
+		}
+		d.buffer = text
+		d.peeked = true
+		return text, true
+	}
+	if err := d.scanner.Err(); err != nil {
+		d.err = fmt.Errorf("sinli: couldn't read: %w", err)
+	}
+	return "", false
+}
+
+// next returns the next non empty line and consumes it.
+func (d *Decoder) next() (string, bool) {
+	line, ok := d.peek()
+	if ok {
+		d.peeked = false
+		d.line++
+	}
+	return line, ok
+}
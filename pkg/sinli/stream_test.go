@@ -0,0 +1,84 @@
+package sinli
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/money"
+)
+
+func TestSinliStream(t *testing.T) {
+	stock := Stock{
+		IdentificationHeader: IdentificationHeader{
+			Format:        FormatTypeNormalized,
+			Document:      FileTypeStock,
+			Version:       FileVersionStock,
+			SourceID:      "12345678",
+			DestinationID: "12345678",
+			// Details are streamed, so records must be counted beforehand
+			Records: 5,
+		},
+		Identification: Identification{
+			SourceEmail:      "source@fakemail.com",
+			DestinationEmail: "destination@fakemail.com",
+			FileType:         FileTypeStock,
+			FileVersion:      FileVersionStock,
+		},
+		Header: StockHeader{
+			ClientName: "Client Name",
+			StockDate:  time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			StockCoin:  CoinEuro,
+		},
+	}
+	details := []StockDetail{
+		{ISBN: "9781234567890", Quantity: 1, PriceWithoutVAT: money.FromCents(101)},
+		{ISBN: "9781234567891", Quantity: 1, PriceWithoutVAT: money.FromCents(99)},
+	}
+
+	// Write the header records and then the details one by one
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(stock); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range details {
+		if err := enc.Encode(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Output must be the same as marshaling the whole document
+	stock.Details = details
+	want, err := Marshal(stock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("want:\n'%s'\ngot:\n'%s'\n", want, buf.Bytes())
+	}
+
+	// Read the header records and then the details one by one
+	dec := NewDecoder(&buf)
+	var got Stock
+	if err := dec.Decode(&got.IdentificationHeader); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&got.Identification); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&got.Header); err != nil {
+		t.Fatal(err)
+	}
+	for dec.More() {
+		var d StockDetail
+		if err := dec.Decode(&d); err != nil {
+			t.Fatal(err)
+		}
+		got.Details = append(got.Details, d)
+	}
+	if !reflect.DeepEqual(got, stock) {
+		t.Fatalf("want:\n%+v\ngot:\n%+v\n", stock, got)
+	}
+}
@@ -0,0 +1,32 @@
+package sinli
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Types shorter than 6 characters are padded with spaces, which are removed
+// along with the rest of whitespaces before matching.
+var subjectRegexp = regexp.MustCompile(`^ESFANDE([A-Z0-9]{8})ESFANDE([A-Z0-9]{8})([A-Z]{1,6})([0-9]{2})FANDE$`)
+
+// ParseSubject parses the subject of an email with a sinli file attached.
+// Whitespaces and case changes introduced by mail clients are ignored.
+func ParseSubject(s string) (Subject, error) {
+	text := strings.ToUpper(strings.Join(strings.Fields(s), ""))
+	m := subjectRegexp.FindStringSubmatch(text)
+	if m == nil {
+		return Subject{}, fmt.Errorf("sinli: invalid subject '%s'", s)
+	}
+	version, err := strconv.Atoi(m[4])
+	if err != nil {
+		return Subject{}, fmt.Errorf("sinli: invalid subject version '%s'", m[4])
+	}
+	return Subject{
+		SourceID:      m[1],
+		DestinationID: m[2],
+		FileType:      FileType(m[3]),
+		FileVersion:   FileVersion(version),
+	}, nil
+}
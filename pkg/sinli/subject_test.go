@@ -0,0 +1,53 @@
+package sinli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSinliParseSubject(t *testing.T) {
+	want := Subject{
+		SourceID:      "L0000001",
+		DestinationID: "LIB00022",
+		FileType:      FileTypeDelivery,
+		FileVersion:   FileVersionDelivery,
+	}
+	b, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marshaled := strings.TrimSpace(string(b))
+	if marshaled != "ESFANDEL0000001ESFANDELIB00022ENVIO 08FANDE" {
+		t.Fatalf("unexpected subject '%s'", marshaled)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "marshaled", input: marshaled},
+		{name: "lower case", input: strings.ToLower(marshaled)},
+		{name: "whitespace", input: "  ESFANDEL0000001\r\n ESFANDELIB00022 ENVIO   08FANDE "},
+		{name: "prefix", input: "ESFANDXL0000001ESFANDELIB00022ENVIO 08FANDE", wantErr: true},
+		{name: "version", input: "ESFANDEL0000001ESFANDELIB00022ENVIO 8FANDE", wantErr: true},
+		{name: "suffix", input: "ESFANDEL0000001ESFANDELIB00022ENVIO 08", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSubject(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error: %s", err)
+			}
+			if got != want {
+				t.Fatalf("want:\n%+v\ngot:\n%+v\n", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package sinli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/igolaizola/agorer/pkg/money"
+)
+
+// Unmarshal parses "sinli" formatted data and stores the result in the value
+// pointed to by v.
+func Unmarshal(data []byte, v interface{}) error {
+	d := NewDecoder(bytes.NewReader(data))
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if line, ok := d.peek(); ok {
+		return fmt.Errorf("sinli: line %d: unexpected record '%s'", d.line+1, line)
+	}
+	return d.err
+}
+
+func (d *Decoder) unmarshal(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		// Read elements while the next line matches the element type
+		elemType := v.Type().Elem()
+		for {
+			line, ok := d.peek()
+			if !ok || !matches(line, elemType, d.format) {
+				return nil
+			}
+			elem := reflect.New(elemType).Elem()
+			if err := d.unmarshal(elem); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, elem))
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.unmarshal(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.unmarshal(v.Elem())
+	case reflect.Struct:
+	default:
+		return errors.New("sinli: value must be a struct")
+	}
+
+	l, err := typeLayout(v.Type())
+	if err != nil {
+		return err
+	}
+
+	// Parse the record line if the struct has plain fields
+	if l.hasRecord() {
+		line, ok := d.next()
+		if !ok {
+			return fmt.Errorf("sinli: unexpected end of data, expected %s", v.Type())
+		}
+		if err := parseRecord(line, v, l, d.format); err != nil {
+			return fmt.Errorf("sinli: line %d: %w", d.line, err)
+		}
+		// Following records use the format of the identification header
+		if v.Type() == reflect.TypeOf(IdentificationHeader{}) {
+			d.format = FormatType(v.FieldByName("Format").String())
+		}
+	}
+
+	// Parse nested records
+	for _, f := range l.nested {
+		field := v.Field(f.index)
+		// Optional records are only parsed if the next line matches them
+		if field.Kind() == reflect.Ptr {
+			if line, ok := d.peek(); !ok || !matches(line, field.Type(), d.format) {
+				field.Set(reflect.Zero(field.Type()))
+				continue
+			}
+		}
+		if err := d.unmarshal(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalDocument reads the identification header without consuming it to
+// obtain the layout of the document and then parses the whole document.
+func (d *Decoder) unmarshalDocument(v reflect.Value) error {
+	line, ok := d.peek()
+	if !ok {
+		return errors.New("sinli: unexpected end of data, expected identification header")
+	}
+	var header IdentificationHeader
+	hv := reflect.ValueOf(&header).Elem()
+	l, err := typeLayout(hv.Type())
+	if err != nil {
+		return err
+	}
+	if err := parseRecord(line, hv, l, header.Format); err != nil {
+		return fmt.Errorf("sinli: line %d: %w", d.line+1, err)
+	}
+	doc, err := New(header.Document, header.Version)
+	if err != nil {
+		return err
+	}
+	if !reflect.TypeOf(doc).AssignableTo(v.Type()) {
+		return fmt.Errorf("sinli: %T is not assignable to %s", doc, v.Type())
+	}
+	if err := d.unmarshal(reflect.ValueOf(doc).Elem()); err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(doc))
+	return nil
+}
+
+// matches returns true if the fixed values of the type are found in the line.
+func matches(line string, t reflect.Type, format FormatType) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	l, err := typeLayout(t)
+	if err != nil {
+		return false
+	}
+	values := recordValues(line, t, l, format)
+	for i, f := range l.record {
+		if f.fixed != "" && strings.TrimRight(values[i].text, " ") != f.fixed {
+			return false
+		}
+	}
+	return true
+}
+
+func parseRecord(line string, v reflect.Value, l *layout, format FormatType) error {
+	if isFree(format, v.Type()) {
+		if n := strings.Count(line, Delimiter) + 1; n > len(l.record) {
+			return fmt.Errorf("%s has %d fields, got %d", v.Type(), len(l.record), n)
+		}
+	}
+	values := recordValues(line, v.Type(), l, format)
+	for i, f := range l.record {
+		field := v.Field(f.index)
+		s := values[i].text
+		column := values[i].column
+
+		name := f.name
+		if f.fixed != "" {
+			if got := strings.TrimRight(s, " "); got != f.fixed {
+				return fmt.Errorf("column %d: %s.%s must be '%s', got '%s'", column, v.Type(), name, f.fixed, got)
+			}
+			continue
+		}
+		// Skip unexported fields
+		if !field.CanSet() {
+			continue
+		}
+		if err := fromString(field, s); err != nil {
+			return fmt.Errorf("column %d: %s.%s: %w", column, v.Type(), name, err)
+		}
+	}
+	return nil
+}
+
+type recordValue struct {
+	text string
+	// Column of the line where the value starts
+	column int
+}
+
+// recordValues splits the line into the values of the record fields.
+// Normalized records are split by the length of the fields and free format
+// records by the delimiter, ignoring any extra values.
+func recordValues(line string, t reflect.Type, l *layout, format FormatType) []recordValue {
+	values := make([]recordValue, len(l.record))
+	if !isFree(format, t) {
+		runes := []rune(line)
+		for i, f := range l.record {
+			values[i] = recordValue{
+				text:   cut(runes, f.offset, f.length),
+				column: f.offset + 1,
+			}
+		}
+		return values
+	}
+	parts := strings.Split(line, Delimiter)
+	column := 1
+	for i := range values {
+		// Lines may have less values than expected if trailing empty values
+		// were removed.
+		values[i].column = column
+		if i < len(parts) {
+			values[i].text = parts[i]
+			column += utf8.RuneCountInString(parts[i]) + 1
+		}
+	}
+	return values
+}
+
+// cut returns the text of the field, lines may be shorter than expected if
+// trailing spaces were removed.
+func cut(runes []rune, offset, length int) string {
+	if offset >= len(runes) {
+		return ""
+	}
+	end := offset + length
+	if end > len(runes) {
+		end = len(runes)
+	}
+	return string(runes[offset:end])
+}
+
+func fromString(v reflect.Value, s string) error {
+	// If the value is a pointer, leave it nil for empty values
+	if v.Kind() == reflect.Ptr {
+		if strings.TrimSpace(s) == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		ptr := reflect.New(v.Type().Elem())
+		if err := fromString(ptr.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+	// Amounts are written in cents, with two implied decimals
+	if v.Type() == amountType {
+		n, err := parseInt(s)
+		if err != nil {
+			return fmt.Errorf("invalid amount '%s'", s)
+		}
+		v.SetInt(int64(money.FromCents(n)))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		switch strings.TrimSpace(s) {
+		case "S":
+			v.SetBool(true)
+		case "N", "":
+			v.SetBool(false)
+		default:
+			return fmt.Errorf("invalid boolean '%s'", s)
+		}
+		return nil
+	// Check if the value is time.Time
+	case reflect.Struct:
+		if v.Type().String() != "time.Time" {
+			break
+		}
+		s = strings.TrimSpace(s)
+		if strings.Trim(s, "0") == "" {
+			v.Set(reflect.ValueOf(time.Time{}))
+			return nil
+		}
+		t, err := time.Parse("20060102", s)
+		if err != nil {
+			return fmt.Errorf("invalid date '%s'", s)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		// Floats are written with two implied decimals
+		n, err := parseInt(s)
+		if err != nil {
+			return fmt.Errorf("invalid decimal '%s'", s)
+		}
+		v.SetFloat(float64(n) / 100)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := parseInt(s)
+		if err != nil || v.OverflowInt(n) {
+			return fmt.Errorf("invalid number '%s'", s)
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.String:
+		v.SetString(strings.TrimRight(s, " "))
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func parseInt(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
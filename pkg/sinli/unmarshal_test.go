@@ -0,0 +1,516 @@
+package sinli
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/money"
+)
+
+func TestSinliUnmarshal(t *testing.T) {
+	date := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	cause := ReturnCauseDamaged
+
+	tests := []struct {
+		name  string
+		input any
+	}{
+		{
+			name: "struct",
+			input: &Bar{
+				Text:    "Hello",
+				Number:  -42,
+				Decimal: -12.34,
+				Boolean: true,
+			},
+		},
+		{
+			name: "nested",
+			input: &Foo{
+				Header: Bar{
+					Text:    "Header",
+					Number:  1,
+					Decimal: 0.01,
+					Boolean: true,
+				},
+				Body: []Bar{
+					{Text: "Hello", Number: 42, Decimal: 12.34, Boolean: true},
+					{Text: "World", Number: -43, Decimal: -12.35},
+				},
+			},
+		},
+		{
+			name: "stock",
+			input: &Stock{
+				IdentificationHeader: IdentificationHeader{
+					Format:        FormatTypeNormalized,
+					Document:      FileTypeStock,
+					Version:       FileVersionStock,
+					SourceID:      "12345678",
+					DestinationID: "12345678",
+					Records:       5,
+				},
+				Identification: Identification{
+					SourceEmail:      "source@fakemail.com",
+					DestinationEmail: "destination@fakemail.com",
+					FileType:         FileTypeStock,
+					FileVersion:      FileVersionStock,
+				},
+				Header: StockHeader{
+					ClientName: "Librería Ñandú",
+					StockDate:  date,
+					StockCoin:  CoinEuro,
+				},
+				Details: []StockDetail{
+					{ISBN: "9781234567890", Quantity: 1, PriceWithoutVAT: money.FromCents(101)},
+					{ISBN: "9781234567891", Quantity: 3, PriceWithoutVAT: money.FromCents(99)},
+				},
+			},
+		},
+		{
+			name: "sale free format",
+			input: &Sale{
+				IdentificationHeader: IdentificationHeader{
+					Format:        FormatTypeFree,
+					Document:      FileTypeSale,
+					Version:       FileVersionSale,
+					SourceID:      "12345678",
+					DestinationID: "12345678",
+					Records:       5,
+				},
+				Identification: Identification{
+					SourceEmail:      "source@fakemail.com",
+					DestinationEmail: "destination@fakemail.com",
+					FileType:         FileTypeSale,
+					FileVersion:      FileVersionSale,
+				},
+				Header: SaleHeader{
+					ClientName:   "Librería Ñandú",
+					DispatchDate: date,
+					Coin:         CoinEuro,
+				},
+				Tickets: []SaleTicket{
+					{
+						SaleDate:   date,
+						SaleNumber: "1235",
+						NetAmount:  money.FromCents(-550),
+						Details: []SaleDetail{
+							{ISBN: "9781234567892", Quantity: -1, PriceWithoutVAT: money.FromCents(550)},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "sale",
+			input: &Sale{
+				IdentificationHeader: IdentificationHeader{
+					Format:        FormatTypeNormalized,
+					Document:      FileTypeSale,
+					Version:       FileVersionSale,
+					SourceID:      "12345678",
+					DestinationID: "12345678",
+					Records:       8,
+				},
+				Identification: Identification{
+					SourceEmail:      "source@fakemail.com",
+					DestinationEmail: "destination@fakemail.com",
+					FileType:         FileTypeSale,
+					FileVersion:      FileVersionSale,
+				},
+				Header: SaleHeader{
+					ClientName:   "Client Name",
+					DispatchDate: date,
+					Coin:         CoinEuro,
+				},
+				Tickets: []SaleTicket{
+					{
+						ClientNumber: 777,
+						SaleDate:     date,
+						SaleNumber:   "1234",
+						NetAmount:    money.FromCents(200),
+						Details: []SaleDetail{
+							{ISBN: "9781234567890", Quantity: 1, PriceWithoutVAT: money.FromCents(101)},
+							{ISBN: "9781234567891", Quantity: 1, PriceWithoutVAT: money.FromCents(99)},
+						},
+					},
+					{
+						SaleDate:   date,
+						SaleNumber: "1235",
+						NetAmount:  money.FromCents(-550),
+						Details: []SaleDetail{
+							{ISBN: "9781234567892", Quantity: -1, PriceWithoutVAT: money.FromCents(550)},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "order",
+			input: &Order{
+				IdentificationHeader: IdentificationHeader{
+					Format:        FormatTypeNormalized,
+					Document:      FileTypeOrder,
+					Version:       FileVersionOrder,
+					SourceID:      "12345678",
+					DestinationID: "12345678",
+					Records:       5,
+				},
+				Identification: Identification{
+					SourceEmail:      "source@fakemail.com",
+					DestinationEmail: "destination@fakemail.com",
+					FileType:         FileTypeOrder,
+					FileVersion:      FileVersionOrder,
+				},
+				Header: OrderHeader{
+					ClientName:            "Client Name",
+					ProviderName:          "Provider Name",
+					OrderDate:             date,
+					OrderCode:             "1234",
+					OrderType:             OrderTypeNormal,
+					Coin:                  LegacyCoinEuro,
+					RequestedDeliveryDate: &date,
+					Batch:                 "1234",
+				},
+				DeliveryPoint: &OrderDeliveryPoint{
+					Name:       "Second shop",
+					Address:    "Main street 1",
+					PostalCode: "20001",
+					City:       "Donostia",
+					Province:   "Gipuzkoa",
+				},
+				Details: []OrderDetail{
+					{
+						ISBN:         "978-1-234-56789-0",
+						EAN:          "978123456789000000",
+						Reference:    "1",
+						Title:        "Título",
+						Quantity:     2,
+						PriceWithVAT: money.FromCents(2080),
+						OrderSource:  OrderSourceClient,
+						Code:         "1234",
+					},
+				},
+			},
+		},
+		{
+			name: "return",
+			input: &Return{
+				IdentificationHeader: IdentificationHeader{
+					Format:        FormatTypeNormalized,
+					Document:      FileTypeReturn,
+					Version:       FileVersionReturn,
+					SourceID:      "12345678",
+					DestinationID: "12345678",
+					Records:       4,
+				},
+				Identification: Identification{
+					SourceEmail:      "source@fakemail.com",
+					DestinationEmail: "destination@fakemail.com",
+					FileType:         FileTypeReturn,
+					FileVersion:      FileVersionReturn,
+				},
+				Header: ReturnHeader{
+					ClientName:   "Client Name",
+					ProviderName: "Provider Name",
+					OrderCode:    "1234",
+					DocumentDate: date,
+					DocumentType: ReturnDocumentTypeDefinitive,
+					ReturnType:   ReturnTypeDefinitive,
+					Coin:         LegacyCoinEuro,
+				},
+				Details: []ReturnDetail{
+					{
+						ISBN:            "978-1-234-56789-0",
+						EAN:             "978123456789000000",
+						Reference:       "1",
+						Title:           "Title",
+						Quantity:        1,
+						PriceWithoutVAT: money.FromCents(2000),
+						PriceWithVAT:    money.FromCents(2080),
+						Discount:        100,
+						PriceType:       PriceTypeFixed,
+						ReturnCause:     &cause,
+					},
+				},
+			},
+		},
+		{
+			name: "delivery",
+			input: &Delivery{
+				IdentificationHeader: IdentificationHeader{
+					Format:        FormatTypeNormalized,
+					Document:      FileTypeDelivery,
+					Version:       FileVersionDelivery,
+					SourceID:      "12345678",
+					DestinationID: "12345678",
+					Records:       6,
+				},
+				Identification: Identification{
+					SourceEmail:      "source@fakemail.com",
+					DestinationEmail: "destination@fakemail.com",
+					FileType:         FileTypeDelivery,
+					FileVersion:      FileVersionDelivery,
+				},
+				Header: DeliveryHeader{
+					ClientName:     "Client Name",
+					ProviderName:   "Provider Name",
+					DeliveryNumber: "A-1234",
+					DeliveryDate:   date,
+					DeliveryType:   DeliveryTypeDefinitive,
+					Coin:           LegacyCoinEuro,
+				},
+				Details: []DeliveryDetail{
+					{
+						ISBN:            "978-1-234-56789-0",
+						EAN:             "9781234567890",
+						Title:           "Title",
+						Quantity:        2,
+						PriceWithoutVAT: money.FromCents(2000),
+						PriceWithVAT:    money.FromCents(2080),
+						Discount:        30,
+						PriceType:       PriceTypeFixed,
+						Novelty:         true,
+						VATRate:         4,
+					},
+					{
+						ISBN:            "978-1-234-56789-1",
+						Title:           "Other title",
+						Quantity:        1,
+						PriceWithoutVAT: money.FromCents(1000),
+						PriceWithVAT:    money.FromCents(1040),
+						Discount:        30,
+						PriceType:       PriceTypeFixed,
+						VATRate:         4,
+					},
+				},
+				Totals: DeliveryTotals{
+					Units:            3,
+					GrossAmount:      money.FromCents(5000),
+					AmountWithoutVAT: money.FromCents(3500),
+					AmountWithVAT:    money.FromCents(3640),
+				},
+			},
+		},
+		{
+			name: "invoice",
+			input: &Invoice{
+				IdentificationHeader: IdentificationHeader{
+					Format:        FormatTypeNormalized,
+					Document:      FileTypeInvoice,
+					Version:       FileVersionInvoice,
+					SourceID:      "12345678",
+					DestinationID: "12345678",
+					Records:       6,
+				},
+				Identification: Identification{
+					SourceEmail:      "source@fakemail.com",
+					DestinationEmail: "destination@fakemail.com",
+					FileType:         FileTypeInvoice,
+					FileVersion:      FileVersionInvoice,
+				},
+				Header: InvoiceHeader{
+					ClientName:    "Client Name",
+					ProviderName:  "Provider Name",
+					InvoiceNumber: "F-1234",
+					InvoiceDate:   date,
+					Coin:          LegacyCoinEuro,
+					DueDate:       &date,
+				},
+				Details: []InvoiceDetail{
+					{
+						DeliveryNumber:  "A-1234",
+						ISBN:            "978-1-234-56789-0",
+						Title:           "Title",
+						Quantity:        2,
+						PriceWithoutVAT: money.FromCents(2000),
+						PriceWithVAT:    money.FromCents(2080),
+						Discount:        30,
+						PriceType:       PriceTypeFixed,
+						NetAmount:       money.FromCents(2800),
+						VATRate:         4,
+					},
+				},
+				Taxes: []InvoiceTax{
+					{
+						VATRate:     4,
+						TaxableBase: money.FromCents(2800),
+						VATAmount:   money.FromCents(112),
+					},
+				},
+				Totals: InvoiceTotals{
+					Units:            2,
+					GrossAmount:      money.FromCents(4000),
+					AmountWithoutVAT: money.FromCents(2800),
+					VATAmount:        money.FromCents(112),
+					AmountWithVAT:    money.FromCents(2912),
+				},
+			},
+		},
+		{
+			name: "catalog",
+			input: &Catalog{
+				IdentificationHeader: IdentificationHeader{
+					Format:        FormatTypeNormalized,
+					Document:      FileTypeCatalog,
+					Version:       FileVersionCatalog,
+					SourceID:      "12345678",
+					DestinationID: "12345678",
+					Records:       4,
+				},
+				Identification: Identification{
+					SourceEmail:      "source@fakemail.com",
+					DestinationEmail: "destination@fakemail.com",
+					FileType:         FileTypeCatalog,
+					FileVersion:      FileVersionCatalog,
+				},
+				Header: CatalogHeader{
+					ProviderName: "Provider Name",
+					CatalogDate:  date,
+					Coin:         CoinEuro,
+				},
+				Books: []CatalogBook{
+					{
+						ISBN:            "978-1-234-56789-0",
+						EAN:             "9781234567890",
+						Title:           "Cien años de soledad",
+						Author:          "García Márquez, Gabriel",
+						Publisher:       "Publisher",
+						PublicationDate: &date,
+						Pages:           471,
+						PriceWithoutVAT: money.FromCents(2000),
+						PriceWithVAT:    money.FromCents(2080),
+						VATRate:         4,
+						PriceType:       PriceTypeFixed,
+						Status:          BookStatusAvailable,
+						Language:        "spa",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Marshal(tt.input)
+			if err != nil {
+				t.Fatalf("couldn't marshal: %s", err)
+			}
+			got := reflect.New(reflect.TypeOf(tt.input).Elem())
+			if err := Unmarshal(b, got.Interface()); err != nil {
+				t.Fatalf("couldn't unmarshal: %s", err)
+			}
+			if !reflect.DeepEqual(got.Interface(), tt.input) {
+				t.Fatalf("want:\n%+v\ngot:\n%+v\n", tt.input, got.Interface())
+			}
+		})
+	}
+}
+
+func TestSinliUnmarshalError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "fixed",
+			input: "XHello     0004201234S\r\n",
+		},
+		{
+			name:  "number",
+			input: "BHello     00A4201234S\r\n",
+		},
+		{
+			name:  "boolean",
+			input: "BHello     0004201234X\r\n",
+		},
+		{
+			name:  "extra",
+			input: "BHello     0004201234S\r\nBWorld     0004201234S\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Bar
+			if err := Unmarshal([]byte(tt.input), &got); err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestSinliUnmarshalRegistered(t *testing.T) {
+	date := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	header := func(version FileVersion) IdentificationHeader {
+		return IdentificationHeader{
+			Format:        FormatTypeNormalized,
+			Document:      FileTypeSale,
+			Version:       version,
+			SourceID:      "12345678",
+			DestinationID: "12345678",
+			Records:       5,
+		}
+	}
+	identification := func(version FileVersion) Identification {
+		return Identification{
+			SourceEmail:      "source@fakemail.com",
+			DestinationEmail: "destination@fakemail.com",
+			FileType:         FileTypeSale,
+			FileVersion:      version,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		input any
+	}{
+		{
+			name: "v3",
+			input: &Sale{
+				IdentificationHeader: header(FileVersionSale),
+				Identification:       identification(FileVersionSale),
+				Header:               SaleHeader{ClientName: "Client Name", DispatchDate: date, Coin: CoinEuro},
+				Tickets: []SaleTicket{
+					{
+						SaleDate:   date,
+						SaleNumber: "1234",
+						NetAmount:  money.FromCents(101),
+						Details: []SaleDetail{
+							{ISBN: "9781234567890", Quantity: 1, PriceWithoutVAT: money.FromCents(101)},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "v2",
+			input: &SaleV2{
+				IdentificationHeader: header(FileVersionSaleV2),
+				Identification:       identification(FileVersionSaleV2),
+				Header:               SaleHeader{ClientName: "Client Name", DispatchDate: date, Coin: CoinEuro},
+				Details: []SaleDetailV2{
+					{SaleDate: date, ISBN: "9781234567890", Quantity: 1, PriceWithoutVAT: money.FromCents(101)},
+					{SaleDate: date, ISBN: "9781234567891", Quantity: 2, PriceWithoutVAT: money.FromCents(99)},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Marshal(tt.input)
+			if err != nil {
+				t.Fatalf("couldn't marshal: %s", err)
+			}
+			var got any
+			if err := Unmarshal(b, &got); err != nil {
+				t.Fatalf("couldn't unmarshal: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.input) {
+				t.Fatalf("want:\n%+v\ngot:\n%+v\n", tt.input, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package sinli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Problem is an issue found while validating a sinli file.
+type Problem struct {
+	Line int
+	// Zero if the problem affects the whole line
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Column == 0 {
+		return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, p.Message)
+}
+
+type validateLine struct {
+	number int
+	text   string
+}
+
+type validator struct {
+	lines    []validateLine
+	pos      int
+	format   FormatType
+	problems []Problem
+}
+
+// Validate reads a sinli file and checks every line against the layout
+// registered for the document type and version of its identification header.
+// It returns the problems found, an error is only returned if the file can't
+// be read.
+func Validate(r io.Reader) ([]Problem, error) {
+	v := &validator{}
+	decoder := charmap.CodePage850.NewDecoder()
+	scanner := bufio.NewScanner(r)
+	var number int
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		text, err := decoder.String(line)
+		if err != nil {
+			v.add(number, 0, fmt.Sprintf("couldn't decode text: %v", err))
+			continue
+		}
+		v.lines = append(v.lines, validateLine{number: number, text: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("sinli: couldn't read: %w", err)
+	}
+	if len(v.lines) == 0 {
+		v.add(1, 0, "missing identification header")
+		return v.problems, nil
+	}
+
+	// Obtain the document layout from the identification header
+	first := v.lines[0]
+	var header IdentificationHeader
+	hv := reflect.ValueOf(&header).Elem()
+	hl, err := typeLayout(hv.Type())
+	if err != nil {
+		return nil, err
+	}
+	if err := parseRecord(first.text, hv, hl, ""); err != nil {
+		// The layout can't be trusted, only the header is checked
+		v.checkRecord(first, hv.Type(), hl)
+		return v.problems, nil
+	}
+	doc, err := New(header.Document, header.Version)
+	if err != nil {
+		v.add(first.number, 0, fmt.Sprintf("unsupported document %s version %d", header.Document, header.Version))
+		return v.problems, nil
+	}
+	v.format = header.Format
+	if v.format != FormatTypeNormalized && v.format != FormatTypeFree {
+		v.add(first.number, 2, fmt.Sprintf("invalid format '%s'", v.format))
+	}
+
+	// Check the records in the order of the layout
+	if err := v.validate(reflect.TypeOf(doc).Elem()); err != nil {
+		return nil, err
+	}
+	for _, line := range v.lines[v.pos:] {
+		v.add(line.number, 0, "unexpected record")
+	}
+
+	// Check the number of records
+	if header.Records != 0 && header.Records != len(v.lines) {
+		var column int
+		values := recordValues(first.text, hv.Type(), hl, "")
+		for i, f := range hl.record {
+			if f.name == "Records" {
+				column = values[i].column
+			}
+		}
+		v.add(first.number, column, fmt.Sprintf("records count is %d, file has %d", header.Records, len(v.lines)))
+	}
+	return v.problems, nil
+}
+
+func (v *validator) add(line, column int, msg string) {
+	v.problems = append(v.problems, Problem{Line: line, Column: column, Message: msg})
+}
+
+// validate consumes the lines of the type, reporting missing records.
+func (v *validator) validate(t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Slice:
+		for v.pos < len(v.lines) && matches(v.lines[v.pos].text, t.Elem(), v.format) {
+			if err := v.validate(t.Elem()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Array:
+		for i := 0; i < t.Len(); i++ {
+			if err := v.validate(t.Elem()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Ptr:
+		// Optional records
+		if v.pos < len(v.lines) && matches(v.lines[v.pos].text, t, v.format) {
+			return v.validate(t.Elem())
+		}
+		return nil
+	}
+
+	l, err := typeLayout(t)
+	if err != nil {
+		return err
+	}
+	if l.hasRecord() {
+		switch {
+		case v.pos >= len(v.lines):
+			v.add(v.lines[len(v.lines)-1].number+1, 0, fmt.Sprintf("missing %s record", t.Name()))
+		case !matches(v.lines[v.pos].text, t, v.format):
+			// The line isn't consumed, it may be the next record
+			v.add(v.lines[v.pos].number, 0, fmt.Sprintf("expected %s record", t.Name()))
+		default:
+			v.checkRecord(v.lines[v.pos], t, l)
+			v.pos++
+		}
+	}
+	for _, f := range l.nested {
+		if err := v.validate(t.Field(f.index).Type); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRecord checks the length of the line and the values of its fields.
+func (v *validator) checkRecord(line validateLine, t reflect.Type, l *layout) {
+	record := l.record
+	free := isFree(v.format, t)
+	if free {
+		if n := strings.Count(line.text, Delimiter) + 1; n != len(record) {
+			v.add(line.number, 0, fmt.Sprintf("%s has %d fields, got %d", t.Name(), len(record), n))
+		}
+	} else {
+		var length int
+		for _, f := range record {
+			length += f.length
+		}
+		if n := utf8.RuneCountInString(line.text); n != length {
+			v.add(line.number, 0, fmt.Sprintf("%s length is %d, got %d", t.Name(), length, n))
+		}
+	}
+	values := recordValues(line.text, t, l, v.format)
+	for i, f := range record {
+		s := values[i].text
+		name := f.name
+		if f.fixed != "" {
+			if got := strings.TrimRight(s, " "); got != f.fixed {
+				v.add(line.number, values[i].column, fmt.Sprintf("%s.%s must be '%s', got '%s'", t.Name(), name, f.fixed, got))
+			}
+			continue
+		}
+		if free && utf8.RuneCountInString(s) > f.length {
+			v.add(line.number, values[i].column, fmt.Sprintf("%s.%s exceeds length %d", t.Name(), name, f.length))
+		}
+		if msg := checkValue(t.Field(f.index).Type, s); msg != "" {
+			v.add(line.number, values[i].column, fmt.Sprintf("%s.%s: %s", t.Name(), name, msg))
+		}
+	}
+}
+
+// checkValue returns a message if the value isn't valid for the type.
+// Blank values are valid, they are read as zero values.
+func checkValue(t reflect.Type, s string) string {
+	if strings.TrimSpace(s) == "" {
+		return ""
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		if s != "S" && s != "N" {
+			return fmt.Sprintf("invalid boolean '%s', must be S or N", s)
+		}
+	case reflect.Struct:
+		if t != reflect.TypeOf(time.Time{}) {
+			break
+		}
+		if strings.Trim(s, "0") == "" {
+			break
+		}
+		if _, err := time.Parse("20060102", s); err != nil {
+			return fmt.Sprintf("invalid date '%s'", s)
+		}
+	case reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Negative values can't be read from zero padded fields
+		if strings.HasPrefix(s, "-") {
+			return fmt.Sprintf("negative number '%s'", s)
+		}
+		if !isNumeric(s) {
+			return fmt.Sprintf("invalid number '%s'", s)
+		}
+	}
+	return ""
+}
+
+// isNumeric returns true if the text is made of digits.
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package sinli
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igolaizola/agorer/pkg/money"
+)
+
+func TestSinliValidate(t *testing.T) {
+	header := "INCEGALD021234567812345678000050000000                                     FANDE\r\n" +
+		"Isource@fakemail.com                               destination@fakemail.com                          CEGALD0200000000\r\n" +
+		"CClient Name                             20210101EUR\r\n"
+	tests := []struct {
+		name  string
+		input string
+		want  []Problem
+	}{
+		{
+			name: "valid",
+			input: header +
+				"D9781234567890    0000010000000101\r\n" +
+				"D9781234567891    0000010000000099\r\n",
+		},
+		{
+			name: "values",
+			input: header +
+				"D9781234567890    00000A0000000101\r\n" +
+				"D9781234567891    0000010000000099   \r\n",
+			want: []Problem{
+				{Line: 4, Column: 19, Message: "StockDetail.Quantity: invalid number '00000A'"},
+				{Line: 5, Message: "StockDetail length is 34, got 37"},
+			},
+		},
+		{
+			name: "negative",
+			input: header +
+				"D9781234567890    000001-000000100\r\n" +
+				"D9781234567891    -000010000000099\r\n",
+			want: []Problem{
+				{Line: 4, Column: 25, Message: "StockDetail.PriceWithoutVAT: negative number '-000000100'"},
+				{Line: 5, Column: 19, Message: "StockDetail.Quantity: negative number '-00001'"},
+			},
+		},
+		{
+			name: "order",
+			input: "INCEGALD021234567812345678000050000000                                     FANDE\r\n" +
+				"Isource@fakemail.com                               destination@fakemail.com                          CEGALD0200000000\r\n" +
+				"D9781234567890    0000010000000101\r\n" +
+				"CClient Name                             20210101EUR\r\n" +
+				"D9781234567891    0000010000000099\r\n",
+			want: []Problem{
+				{Line: 3, Message: "expected StockHeader record"},
+				{Line: 4, Message: "unexpected record"},
+				{Line: 5, Message: "unexpected record"},
+			},
+		},
+		{
+			name: "records",
+			input: header +
+				"D9781234567890    0000010000000101\r\n",
+			want: []Problem{
+				{Line: 1, Column: 27, Message: "records count is 5, file has 4"},
+			},
+		},
+		{
+			name:  "unsupported",
+			input: "INCEGALD991234567812345678000050000000                                     FANDE\r\n",
+			want: []Problem{
+				{Line: 1, Message: "unsupported document CEGALD version 99"},
+			},
+		},
+		{
+			name: "free format",
+			input: "ILCEGALD021234567812345678000050000000                                     FANDE\r\n" +
+				"I|source@fakemail.com|destination@fakemail.com|CEGALD|2|0\r\n" +
+				"C|Client Name|20211301|EUR\r\n" +
+				"D|9781234567890|1|101\r\n" +
+				"D|9781234567891|X|99|\r\n",
+			want: []Problem{
+				{Line: 3, Column: 15, Message: "StockHeader.StockDate: invalid date '20211301'"},
+				{Line: 5, Message: "StockDetail has 4 fields, got 5"},
+				{Line: 5, Column: 17, Message: "StockDetail.Quantity: invalid number 'X'"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Validate(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("expected nil, got error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("want:\n%+v\ngot:\n%+v\n", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSinliValidateMarshalled(t *testing.T) {
+	// Negative values are written when strict mode is disabled, but the file
+	// must not pass validation
+	stock := Stock{
+		IdentificationHeader: IdentificationHeader{
+			Format:   FormatTypeNormalized,
+			Document: FileTypeStock,
+			Version:  FileVersionStock,
+		},
+		Identification: Identification{
+			FileType:    FileTypeStock,
+			FileVersion: FileVersionStock,
+		},
+		Header: StockHeader{ClientName: "Client Name", StockDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), StockCoin: CoinEuro},
+		Details: []StockDetail{
+			{ISBN: "9781234567890", Quantity: 3, PriceWithoutVAT: money.New(-1)},
+		},
+	}
+	b, err := Marshal(stock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Validate(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !strings.Contains(got[0].Message, "StockDetail.PriceWithoutVAT: negative number") {
+		t.Fatalf("want negative price problem, got %+v", got)
+	}
+}